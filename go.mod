@@ -10,11 +10,14 @@ require (
 	github.com/gin-gonic/gin v1.7.7
 	github.com/isayme/go-amqp-reconnect v0.0.0-20210303120416-fc811b0bcda2
 	github.com/joho/godotenv v1.4.0
+	github.com/microcosm-cc/bluemonday v1.0.18
 	github.com/streadway/amqp v1.0.0
 	github.com/tidwall/gjson v1.12.0 // indirect
 	github.com/vincentinttsh/replace v1.0.3
 	github.com/vincentinttsh/zero v1.0.2
+	github.com/yuin/goldmark v1.4.4
 	gopkg.in/go-playground/assert.v1 v1.2.1
+	gopkg.in/yaml.v2 v2.2.8
 	gorm.io/driver/postgres v1.2.2
 	gorm.io/driver/sqlite v1.2.6
 	gorm.io/gorm v1.22.3
@@ -3,15 +3,48 @@ package judgeservice
 import (
 	"encoding/json"
 	"errors"
-	"log"
-	"os"
+	"sync"
 
-	"github.com/gin-gonic/gin"
-	"github.com/isayme/go-amqp-reconnect/rabbitmq"
-	"github.com/joho/godotenv"
-	"github.com/streadway/amqp"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/queue"
 )
 
+// QueueName judge task queue of practice submissions
+const QueueName = "program_submission"
+
+// ContestQueueName judge task queue of contest submissions, judged before QueueName
+const ContestQueueName = "program_submission_contest"
+
+// RejudgeQueueName judge task queue of bulk rejudges and reference solution runs, judged last
+const RejudgeQueueName = "program_submission_rejudge"
+
+// Priority of a judge task, decides which lane the task is published to
+const (
+	PriorityRejudge = -1
+	PriorityNormal  = 0
+	PriorityContest = 1
+)
+
+// Lanes judge task queues from the highest priority to the lowest
+var Lanes = []string{ContestQueueName, QueueName, RejudgeQueueName}
+
+// LaneOf returns the judge task queue of the priority
+func LaneOf(priority int) string {
+	switch {
+	case priority > PriorityNormal:
+		return ContestQueueName
+	case priority < PriorityNormal:
+		return RejudgeQueueName
+	default:
+		return QueueName
+	}
+}
+
+// ResultQueueName judge result queue, rejected results go to ResultDeadLetterName
+const ResultQueueName = "judge_result"
+
+// ResultDeadLetterName dead-letter queue of malformed judge results
+const ResultDeadLetterName = "judge_result.dead"
+
 // JudgeTask is a template for a judge task
 type JudgeTask struct {
 	SourceCode   string `json:"source_code"`
@@ -20,52 +53,92 @@ type JudgeTask struct {
 	MemoryLimit  uint   `json:"max_memory"`
 	SubmissionID uint   `json:"submission_id"`
 	ProblemID    uint   `json:"test_case_id"`
+	TestCaseRef  string `json:"test_case_ref"`
 	ProgramName  string `json:"program_name"`
+	Priority     int    `json:"priority"`
 }
 
-var supportedLanguage = map[string]bool{
-	"clang":   true,
-	"cpp":     true,
-	"java":    true,
-	"python3": true,
+// TaskTypeValidate marks a task which runs a validator on every test case input
+const TaskTypeValidate = "validate"
+
+// ValidateTask is a template for a validator task, it shares the judge queue
+type ValidateTask struct {
+	Type        string `json:"type"`
+	SourceCode  string `json:"source_code"`
+	Language    string `json:"language"`
+	ProblemID   uint   `json:"test_case_id"`
+	RunID       uint   `json:"run_id"` // 驗證結果需帶回 run_id，舊的驗證結果會被捨棄
+	TestCaseRef string `json:"test_case_ref"`
 }
-var conn *rabbitmq.Connection
-var channel *rabbitmq.Channel
-var queue amqp.Queue
 
-func failOnError(err error, msg string) {
-	if err != nil {
-		log.Fatalf("%s: %s", msg, err)
-	}
+// TaskTypeRun marks a task which runs the source code on inline input without stored test cases
+const TaskTypeRun = "run"
+
+// RunTask is a template for a custom input run, it shares the judge queue and is never graded
+type RunTask struct {
+	Type        string `json:"type"`
+	RunID       uint   `json:"run_id"`
+	SourceCode  string `json:"source_code"`
+	Language    string `json:"language"`
+	CPUTime     uint   `json:"max_cpu_time"`
+	MemoryLimit uint   `json:"max_memory"`
+	ProgramName string `json:"program_name"`
+	Input       string `json:"input"`
 }
 
-// Setup connect rabbitmq
-func Setup() {
-	var err error
+// TaskTypeSample marks a task which runs the source code on the problem samples only
+const TaskTypeSample = "sample"
 
-	if gin.Mode() == "test" {
-		return
+// SampleCase is a problem sample sent inline with a sample task
+type SampleCase struct {
+	Sort   uint   `json:"sort"`
+	Input  string `json:"input"`
+	Output string `json:"output"`
+}
+
+// SampleTask is a template for a sample pre-check before the full judge task is queued
+type SampleTask struct {
+	Type         string       `json:"type"`
+	SubmissionID uint         `json:"submission_id"`
+	SourceCode   string       `json:"source_code"`
+	Language     string       `json:"language"`
+	CPUTime      uint         `json:"max_cpu_time"`
+	MemoryLimit  uint         `json:"max_memory"`
+	ProgramName  string       `json:"program_name"`
+	Priority     int          `json:"priority"`
+	Samples      []SampleCase `json:"samples"`
+}
+
+var mu sync.RWMutex
+var supportedLanguage = map[string]bool{}
+
+// SetLanguages replaces the supported languages, loaded from the language registry
+func SetLanguages(names []string) {
+	languages := make(map[string]bool, len(names))
+	for _, name := range names {
+		languages[name] = true
 	}
-	if gin.Mode() == "debug" {
-		err = godotenv.Load()
-		if err != nil {
-			log.Println("Error loading .env file")
+
+	mu.Lock()
+	defer mu.Unlock()
+	supportedLanguage = languages
+}
+
+// supported reports whether the language is supported
+func supported(name string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return supportedLanguage[name]
+}
+
+// Setup declare the judge queues of every lane
+func Setup(q queue.TaskQueue) (err error) {
+	for _, lane := range Lanes {
+		if err = q.Declare(lane); err != nil {
+			return
 		}
 	}
-
-	conn, err = rabbitmq.Dial(os.Getenv("RABBITMQ_HOST"))
-	failOnError(err, "Failed to connect to RabbitMQ")
-	channel, err = conn.Channel()
-	failOnError(err, "Failed to open a channel")
-	queue, err = channel.QueueDeclare(
-		"program_submission", // name
-		true,                 // durable
-		false,                // delete when unused
-		false,                // exclusive
-		false,                // no-wait
-		nil,                  // arguments
-	)
-	failOnError(err, "Failed to declare a queue")
+	return
 }
 
 // ErrUnsupportedLanguage is returned when the language is not supported
@@ -73,35 +146,71 @@ var ErrUnsupportedLanguage = errors.New("unsupported language")
 
 // Validate validates the judge task
 func (j *JudgeTask) Validate() error {
-	if _, ok := supportedLanguage[j.Language]; !ok {
+	if !supported(j.Language) {
 		return ErrUnsupportedLanguage
 	}
 	return nil
 }
 
-// Run  Run a new submission
-func (j *JudgeTask) Run() (err error) {
+// Run  Run a new submission on the lane of its priority
+func (j *JudgeTask) Run(q queue.Publisher) (err error) {
 	var data []byte
 
 	if data, err = json.Marshal(j); err != nil {
 		return
 	}
 
-	if gin.Mode() == "test" {
+	return q.Publish(LaneOf(j.Priority), data)
+}
+
+// Validate validates the validator task
+func (v *ValidateTask) Validate() error {
+	if !supported(v.Language) {
+		return ErrUnsupportedLanguage
+	}
+	return nil
+}
+
+// Run request a validator run on the problem test cases
+func (v *ValidateTask) Run(q queue.Publisher) (err error) {
+	var data []byte
+
+	v.Type = TaskTypeValidate
+	if data, err = json.Marshal(v); err != nil {
 		return
 	}
 
-	err = channel.Publish(
-		"",         // exchange
-		queue.Name, // routing key
-		false,      // mandatory
-		false,
-		amqp.Publishing{
-			DeliveryMode: amqp.Persistent,
-			ContentType:  "text/json",
-			Body:         data,
-		},
-	)
+	return q.Publish(QueueName, data)
+}
 
-	return
+// Validate validates the custom input run task
+func (r *RunTask) Validate() error {
+	if !supported(r.Language) {
+		return ErrUnsupportedLanguage
+	}
+	return nil
+}
+
+// Run request a custom input run
+func (r *RunTask) Run(q queue.Publisher) (err error) {
+	var data []byte
+
+	r.Type = TaskTypeRun
+	if data, err = json.Marshal(r); err != nil {
+		return
+	}
+
+	return q.Publish(QueueName, data)
+}
+
+// Run request a sample pre-check on the lane of its priority
+func (t *SampleTask) Run(q queue.Publisher) (err error) {
+	var data []byte
+
+	t.Type = TaskTypeSample
+	if data, err = json.Marshal(t); err != nil {
+		return
+	}
+
+	return q.Publish(LaneOf(t.Priority), data)
 }
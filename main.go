@@ -7,28 +7,83 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/NCNUCodeOJ/BackendQuestionDatabase/judgeservice"
 	"github.com/NCNUCodeOJ/BackendQuestionDatabase/models"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/queue"
 	router "github.com/NCNUCodeOJ/BackendQuestionDatabase/routers"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/storage"
 	"github.com/NCNUCodeOJ/BackendQuestionDatabase/styleservice"
 	"github.com/NCNUCodeOJ/BackendQuestionDatabase/views"
 	"github.com/gin-gonic/gin"
 )
 
 var srv *http.Server
+var taskQueue queue.TaskQueue
+var stopWorkers = make(chan struct{})
+
+// getEnvInt read a positive integer environment variable, or return the default value
+func getEnvInt(key string, value int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return value
+}
+
+// setupQueue connect to RabbitMQ, or use an in-memory queue when QUEUE_DRIVER is memory
+func setupQueue() queue.TaskQueue {
+	if os.Getenv("QUEUE_DRIVER") == "memory" {
+		log.Println("Using in-memory task queue")
+		return queue.NewMemory()
+	}
+
+	q, err := queue.NewRabbitMQ(os.Getenv("RABBITMQ_HOST"))
+	if err != nil {
+		log.Fatal("Failed to connect to RabbitMQ: ", err)
+	}
+	return q
+}
 
 func start() {
 	models.Setup()
 
-	judgeservice.Setup()
-	styleservice.Setup()
+	taskQueue = setupQueue()
+	if err := judgeservice.Setup(taskQueue); err != nil {
+		log.Fatal("Failed to declare a queue: ", err)
+	}
+	if err := styleservice.Setup(taskQueue); err != nil {
+		log.Fatal("Failed to declare a queue: ", err)
+	}
+	storage.Setup()
 
 	views.Setup()
+	views.StartLanguageReload(
+		time.Duration(getEnvInt("LANGUAGE_RELOAD_INTERVAL", 60))*time.Second,
+		stopWorkers,
+	)
+	views.StartSweeper(
+		taskQueue,
+		time.Duration(getEnvInt("SWEEPER_INTERVAL", 60))*time.Second,
+		time.Duration(getEnvInt("STUCK_THRESHOLD", 600))*time.Second,
+		uint(getEnvInt("MAX_JUDGE_ATTEMPTS", 3)),
+		stopWorkers,
+	)
+	views.StartOutboxRelay(
+		taskQueue,
+		time.Duration(getEnvInt("OUTBOX_INTERVAL", 5))*time.Second,
+		time.Duration(getEnvInt("OUTBOX_RETENTION", 24))*time.Hour,
+		stopWorkers,
+	)
+	if os.Getenv("RESULT_QUEUE") == "1" {
+		if err := views.StartResultConsumer(taskQueue); err != nil {
+			log.Fatal("Failed to consume result queues: ", err)
+		}
+	}
 
-	r := router.SetupRouter()
+	r := router.SetupRouter(taskQueue)
 	if gin.Mode() == "debug" {
 		srv = &http.Server{
 			Addr:    "localhost:8080",
@@ -59,6 +114,9 @@ func end() {
 		log.Fatal("Server forced to shutdown:", err)
 	}
 
+	close(stopWorkers)
+	taskQueue.Close()
+
 	log.Println("Server exiting")
 }
 
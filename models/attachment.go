@@ -0,0 +1,50 @@
+package models
+
+import "gorm.io/gorm"
+
+// ProblemAttachment 題目的附件，例如敘述中的圖片與資料檔，檔案存在 storage - database
+type ProblemAttachment struct {
+	gorm.Model
+	ProblemID   uint   `gorm:"NOT NULL;uniqueIndex:idx_problem_attachment"`
+	Name        string `gorm:"type:varchar(100);NOT NULL;uniqueIndex:idx_problem_attachment"`
+	ContentType string `gorm:"type:varchar(100);NOT NULL"`
+	Size        int64  `gorm:"NOT NULL"`
+	Author      uint   `gorm:"NOT NULL"`
+}
+
+// SetProblemAttachment 新增題目的附件，取代同名的附件
+func SetProblemAttachment(attachment *ProblemAttachment) (err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		where := &ProblemAttachment{ProblemID: attachment.ProblemID, Name: attachment.Name}
+		if err := tx.Unscoped().Where(where).Delete(&ProblemAttachment{}).Error; err != nil {
+			return err
+		}
+		attachment.ID = 0
+		return tx.Create(attachment).Error
+	})
+	return
+}
+
+// GetProblemAttachment 查詢題目的附件
+func GetProblemAttachment(problemID uint, name string) (attachment ProblemAttachment, err error) {
+	err = DB.Where(&ProblemAttachment{ProblemID: problemID, Name: name}).First(&attachment).Error
+	return
+}
+
+// GetProblemAttachments 查詢題目所有的附件，依名稱排序
+func GetProblemAttachments(problemID uint) (attachments []ProblemAttachment, err error) {
+	err = DB.Where(&ProblemAttachment{ProblemID: problemID}).Order("name").Find(&attachments).Error
+	return
+}
+
+// DeleteProblemAttachment 刪除題目的附件，沒有附件時回傳 gorm.ErrRecordNotFound
+func DeleteProblemAttachment(problemID uint, name string) (err error) {
+	result := DB.Unscoped().Where(&ProblemAttachment{ProblemID: problemID, Name: name}).Delete(&ProblemAttachment{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return
+}
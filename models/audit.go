@@ -0,0 +1,29 @@
+package models
+
+import "gorm.io/gorm"
+
+// AuditLog 刪除、還原與清除題目等操作的記錄 - database
+type AuditLog struct {
+	gorm.Model
+	UserID    uint   `gorm:"NOT NULL"`
+	Action    string `gorm:"type:varchar(20);NOT NULL"`
+	ProblemID uint   `gorm:"NOT NULL;index"`
+	Detail    string `gorm:"type:text"` // json
+}
+
+// 記錄的操作
+const (
+	AuditDeleteProblem  = "delete_problem"
+	AuditRestoreProblem = "restore_problem"
+	AuditPurgeProblem   = "purge_problem"
+)
+
+// GetAuditLogs 查詢操作記錄，problemID 為 0 時查詢所有題目，由新到舊
+func GetAuditLogs(problemID uint, limit int) (logs []AuditLog, err error) {
+	query := DB.Order("id desc").Limit(limit)
+	if problemID != 0 {
+		query = query.Where("problem_id = ?", problemID)
+	}
+	err = query.Find(&logs).Error
+	return
+}
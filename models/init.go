@@ -56,6 +56,23 @@ func AutoMigrateAll() {
 	DB.AutoMigrate(&Submission{})
 	DB.AutoMigrate(&SubTask{})
 	DB.AutoMigrate(&Wrong{})
+	DB.AutoMigrate(&Validator{})
+	DB.AutoMigrate(&TestCaseValidation{})
+	DB.AutoMigrate(&ReferenceSolution{})
+	DB.AutoMigrate(&Outbox{})
+	DB.AutoMigrate(&Language{})
+	DB.AutoMigrate(&ProblemLanguage{})
+	DB.AutoMigrate(&CustomRun{})
+	DB.AutoMigrate(&SampleResult{})
+	DB.AutoMigrate(&ProblemRevision{})
+	DB.AutoMigrate(&ProblemShare{})
+	DB.AutoMigrate(&ProblemPermission{})
+	DB.AutoMigrate(&AuditLog{})
+	DB.AutoMigrate(&ProblemTranslation{})
+	DB.AutoMigrate(&ProblemAttachment{})
+	if err := seedLanguages(); err != nil {
+		log.Println("Error seeding languages:", err)
+	}
 }
 
 //Ping ping a database
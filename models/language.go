@@ -0,0 +1,43 @@
+package models
+
+import "gorm.io/gorm"
+
+// Language 程式語言 - database
+type Language struct {
+	gorm.Model
+	Name             string  `gorm:"type:varchar(20);NOT NULL;uniqueIndex"` // judge service 使用的名稱
+	DisplayName      string  `gorm:"type:text;NOT NULL"`
+	Version          string  `gorm:"type:text;NOT NULL"`
+	CompileCommand   string  `gorm:"type:text"` // judge service 的編譯指令樣板名稱，直譯語言為空
+	RunCommand       string  `gorm:"type:text;NOT NULL"`
+	TimeMultiplier   float64 `gorm:"NOT NULL;default:1"`
+	MemoryMultiplier float64 `gorm:"NOT NULL;default:1"`
+	StyleCheck       bool    `gorm:"NOT NULL;default:false"` // 是否支援 style service 檢查
+	Enabled          bool    `gorm:"NOT NULL;default:true"`
+}
+
+// defaultLanguages judge service 預設支援的語言
+var defaultLanguages = []Language{
+	{Name: "clang", DisplayName: "C", Version: "gcc 9", CompileCommand: "clang", RunCommand: "native", TimeMultiplier: 1, MemoryMultiplier: 1, Enabled: true},
+	{Name: "cpp", DisplayName: "C++", Version: "g++ 9", CompileCommand: "cpp", RunCommand: "native", TimeMultiplier: 1, MemoryMultiplier: 1, Enabled: true},
+	{Name: "java", DisplayName: "Java", Version: "OpenJDK 11", CompileCommand: "java", RunCommand: "java", TimeMultiplier: 1, MemoryMultiplier: 1, StyleCheck: true, Enabled: true},
+	{Name: "python3", DisplayName: "Python 3", Version: "3.8", RunCommand: "python3", TimeMultiplier: 1, MemoryMultiplier: 1, StyleCheck: true, Enabled: true},
+}
+
+// seedLanguages 語言表為空時建立預設語言
+func seedLanguages() (err error) {
+	var count int64
+
+	if err = DB.Model(&Language{}).Count(&count).Error; err != nil || count > 0 {
+		return
+	}
+	languages := append([]Language(nil), defaultLanguages...)
+	err = DB.Create(&languages).Error
+	return
+}
+
+// ListLanguages 查詢所有啟用的語言
+func ListLanguages() (languages []Language, err error) {
+	err = DB.Where("enabled = ?", true).Order("id").Find(&languages).Error
+	return
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Outbox 待送出的 task - database
+type Outbox struct {
+	gorm.Model
+	Queue   string `gorm:"type:text;NOT NULL"`
+	Payload []byte `gorm:"NOT NULL"`
+	Sent    bool   `gorm:"NOT NULL;default:false;index"`
+	SentAt  *time.Time
+}
+
+// OutboxWriter 將 task 寫入 outbox，與 queue.Publisher 相容
+type OutboxWriter struct {
+	tx      *gorm.DB
+	Written []Outbox
+}
+
+// NewOutboxWriter 建立寫入 outbox 的 writer
+func NewOutboxWriter() *OutboxWriter {
+	return &OutboxWriter{tx: DB}
+}
+
+// Publish 將 task 寫入 outbox，由 relay 送至 queue
+func (w *OutboxWriter) Publish(name string, body []byte) (err error) {
+	outbox := Outbox{Queue: name, Payload: body}
+
+	if err = w.tx.Create(&outbox).Error; err != nil {
+		return
+	}
+	w.Written = append(w.Written, outbox)
+	return
+}
+
+// GetPendingOutbox 查詢 before 之前建立且尚未送出的 task，依建立順序排列
+func GetPendingOutbox(before time.Time, limit int) (outboxes []Outbox, err error) {
+	err = DB.Where("sent = ? AND created_at <= ?", false, before).
+		Order("id").Limit(limit).Find(&outboxes).Error
+	return
+}
+
+// DeleteSentOutbox 刪除 before 之前送出的 task，回傳刪除的數量
+func DeleteSentOutbox(before time.Time) (deleted int64, err error) {
+	result := DB.Unscoped().Where("sent = ? AND sent_at < ?", true, before).Delete(&Outbox{})
+	return result.RowsAffected, result.Error
+}
+
+// MarkOutboxSent 標記 task 已送出
+func MarkOutboxSent(id uint) (err error) {
+	err = DB.Model(&Outbox{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"sent":    true,
+		"sent_at": time.Now(),
+	}).Error
+	return
+}
@@ -0,0 +1,35 @@
+package models
+
+import "gorm.io/gorm"
+
+// ProblemLanguage problem 允許的語言與該語言的限制 - database
+type ProblemLanguage struct {
+	gorm.Model
+	ProblemID   uint   `gorm:"NOT NULL;index"`
+	Language    string `gorm:"type:varchar(20);NOT NULL"`
+	CPUTime     uint   `gorm:"NOT NULL;default:0"` // 0 表示使用 problem 的限制
+	MemoryLimit uint   `gorm:"NOT NULL;default:0"` // 0 表示使用 problem 的限制
+}
+
+// SetProblemLanguages 取代 problem 允許的語言，空的列表表示不限制語言
+func SetProblemLanguages(problemID uint, languages []ProblemLanguage) (err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where(&ProblemLanguage{ProblemID: problemID}).Delete(&ProblemLanguage{}).Error; err != nil {
+			return err
+		}
+		for _, language := range languages {
+			language.ProblemID = problemID
+			if err := tx.Create(&language).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// GetProblemLanguages 查詢 problem 允許的語言
+func GetProblemLanguages(problemID uint) (languages []ProblemLanguage, err error) {
+	err = DB.Where(&ProblemLanguage{ProblemID: problemID}).Order("id").Find(&languages).Error
+	return
+}
@@ -0,0 +1,54 @@
+package models
+
+import "gorm.io/gorm"
+
+// ProblemPermission 題目的共同作者與檢視者 - database
+type ProblemPermission struct {
+	gorm.Model
+	ProblemID uint   `gorm:"NOT NULL;uniqueIndex:idx_problem_permission"`
+	UserID    uint   `gorm:"NOT NULL;uniqueIndex:idx_problem_permission"`
+	Role      string `gorm:"type:varchar(10);NOT NULL"`
+}
+
+// 題目權限，題目的 Author 為 owner
+const (
+	RoleOwner  = "owner"  // 可以管理權限與公開狀態
+	RoleEditor = "editor" // 可以編輯題目與 test case
+	RoleViewer = "viewer" // 可以看到未公開的題目、test case 與提交細節
+)
+
+// SetProblemPermission 設定使用者在題目的權限，取代原本的權限
+func SetProblemPermission(problemID, userID uint, role string) (err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		where := &ProblemPermission{ProblemID: problemID, UserID: userID}
+		if err := tx.Unscoped().Where(where).Delete(&ProblemPermission{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&ProblemPermission{ProblemID: problemID, UserID: userID, Role: role}).Error
+	})
+	return
+}
+
+// DeleteProblemPermission 移除使用者在題目的權限，沒有權限時回傳 gorm.ErrRecordNotFound
+func DeleteProblemPermission(problemID, userID uint) (err error) {
+	result := DB.Unscoped().Where(&ProblemPermission{ProblemID: problemID, UserID: userID}).Delete(&ProblemPermission{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return
+}
+
+// GetProblemPermission 查詢使用者在題目的權限
+func GetProblemPermission(problemID, userID uint) (permission ProblemPermission, err error) {
+	err = DB.Where(&ProblemPermission{ProblemID: problemID, UserID: userID}).First(&permission).Error
+	return
+}
+
+// GetProblemPermissions 查詢題目所有被授權的使用者
+func GetProblemPermissions(problemID uint) (permissions []ProblemPermission, err error) {
+	err = DB.Where(&ProblemPermission{ProblemID: problemID}).Order("id").Find(&permissions).Error
+	return
+}
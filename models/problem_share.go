@@ -0,0 +1,40 @@
+package models
+
+import "gorm.io/gorm"
+
+// ProblemShare 狀態為 shared 的題目分享的群組或競賽 - database
+type ProblemShare struct {
+	gorm.Model
+	ProblemID uint   `gorm:"NOT NULL;index"`
+	Kind      string `gorm:"type:varchar(10);NOT NULL"` // group 或 contest
+	TargetID  uint   `gorm:"NOT NULL"`
+}
+
+// 分享的對象
+const (
+	ShareGroup   = "group"
+	ShareContest = "contest"
+)
+
+// SetProblemShares 設定題目分享的對象，取代原本的設定
+func SetProblemShares(problemID uint, shares []ProblemShare) (err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where(&ProblemShare{ProblemID: problemID}).Delete(&ProblemShare{}).Error; err != nil {
+			return err
+		}
+		for _, share := range shares {
+			share.ProblemID = problemID
+			if err := tx.Create(&share).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// GetProblemShares 查詢題目分享的對象
+func GetProblemShares(problemID uint) (shares []ProblemShare, err error) {
+	err = DB.Where(&ProblemShare{ProblemID: problemID}).Order("id").Find(&shares).Error
+	return
+}
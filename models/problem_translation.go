@@ -0,0 +1,83 @@
+package models
+
+import "gorm.io/gorm"
+
+// DefaultLocale 題目預設的語言
+const DefaultLocale = "zh-TW"
+
+// ProblemTranslation 題目敘述的翻譯，題目本身的敘述為 Problem.DefaultLocale - database
+type ProblemTranslation struct {
+	gorm.Model
+	ProblemID         uint   `gorm:"NOT NULL;uniqueIndex:idx_problem_translation"`
+	Locale            string `gorm:"type:varchar(16);NOT NULL;uniqueIndex:idx_problem_translation"`
+	ProblemName       string `gorm:"type:text;"`
+	Description       string `gorm:"type:text;"`
+	InputDescription  string `gorm:"type:text;"`
+	OutputDescription string `gorm:"type:text"`
+}
+
+// SetProblemTranslation 設定題目在 locale 的翻譯，取代原本的翻譯
+func SetProblemTranslation(translation *ProblemTranslation) (err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		where := &ProblemTranslation{ProblemID: translation.ProblemID, Locale: translation.Locale}
+		if err := tx.Unscoped().Where(where).Delete(&ProblemTranslation{}).Error; err != nil {
+			return err
+		}
+		translation.ID = 0
+		return tx.Create(translation).Error
+	})
+	return
+}
+
+// GetProblemTranslation 查詢題目在 locale 的翻譯
+func GetProblemTranslation(problemID uint, locale string) (translation ProblemTranslation, err error) {
+	err = DB.Where(&ProblemTranslation{ProblemID: problemID, Locale: locale}).First(&translation).Error
+	return
+}
+
+// GetProblemTranslations 查詢題目所有的翻譯，依 locale 排序
+func GetProblemTranslations(problemID uint) (translations []ProblemTranslation, err error) {
+	err = DB.Where(&ProblemTranslation{ProblemID: problemID}).Order("locale").Find(&translations).Error
+	return
+}
+
+// DeleteProblemTranslation 刪除題目在 locale 的翻譯，沒有翻譯時回傳 gorm.ErrRecordNotFound
+func DeleteProblemTranslation(problemID uint, locale string) (err error) {
+	result := DB.Unscoped().Where(&ProblemTranslation{ProblemID: problemID, Locale: locale}).Delete(&ProblemTranslation{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return
+}
+
+// SetProblemDefaultLocale 更新題目的預設語言與敘述，在同一個 transaction 中刪除新預設語言的翻譯
+// previous 不為 nil 時保存原本預設語言的敘述為翻譯
+func SetProblemDefaultLocale(problem *Problem, previous *ProblemTranslation) (err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		where := &ProblemTranslation{ProblemID: problem.ID, Locale: problem.DefaultLocale}
+		if err := tx.Unscoped().Where(where).Delete(&ProblemTranslation{}).Error; err != nil {
+			return err
+		}
+		if previous != nil {
+			where = &ProblemTranslation{ProblemID: previous.ProblemID, Locale: previous.Locale}
+			if err := tx.Unscoped().Where(where).Delete(&ProblemTranslation{}).Error; err != nil {
+				return err
+			}
+			previous.ID = 0
+			if err := tx.Create(previous).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(problem).Error
+	})
+	return
+}
+
+// DeleteProblemAllTranslations 刪除題目所有的翻譯
+func DeleteProblemAllTranslations(problemID uint) (err error) {
+	err = DB.Unscoped().Where(&ProblemTranslation{ProblemID: problemID}).Delete(&ProblemTranslation{}).Error
+	return
+}
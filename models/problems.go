@@ -1,6 +1,10 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 //Problem Database - database
 type Problem struct {
@@ -15,6 +19,42 @@ type Problem struct {
 	CPUTime           uint   `gorm:"NOT NULL;"`
 	Layer             uint8  `gorm:"NOT NULL;"`
 	HasTestCase       bool   `gorm:"NOT NULL;default:false"`
+	// 上傳 test case 時的正規化設定
+	NormalizeCRLF      bool `gorm:"NOT NULL;default:false"`
+	NormalizeBOM       bool `gorm:"NOT NULL;default:false"`
+	TrimTrailingSpace  bool `gorm:"NOT NULL;default:false"`
+	EnsureFinalNewline bool `gorm:"NOT NULL;default:false"`
+	// 題目公開狀態，建立題目時為 draft，舊題目為 public
+	Visibility string     `gorm:"type:varchar(10);NOT NULL;default:public"`
+	PublishAt  *time.Time // 排程公開的時間，到達後視為 public
+	// 複製來源的題目，0 表示不是複製的題目
+	SourceProblemID uint `gorm:"NOT NULL;default:0"`
+	// 題目本身敘述的語言，其他語言的敘述為 ProblemTranslation
+	DefaultLocale string `gorm:"type:varchar(16);NOT NULL;default:zh-TW"`
+}
+
+// 題目公開狀態
+const (
+	VisibilityDraft   = "draft"   // 草稿，僅有題目權限的使用者可見，不會排程公開也不會出現在題目列表
+	VisibilityPrivate = "private" // 僅有題目權限的使用者可見
+	VisibilityShared  = "shared"  // 分享給特定群組或競賽
+	VisibilityPublic  = "public"  // 所有使用者可見
+)
+
+// EffectiveVisibility 考慮排程公開後，題目在 now 時的公開狀態，草稿不會排程公開
+func (problem *Problem) EffectiveVisibility(now time.Time) string {
+	if problem.Visibility != VisibilityDraft && problem.PublishAt != nil && !now.Before(*problem.PublishAt) {
+		return VisibilityPublic
+	}
+	return problem.Visibility
+}
+
+// StatementLocale 題目本身敘述的語言，未設定時為 DefaultLocale
+func (problem *Problem) StatementLocale() string {
+	if problem.DefaultLocale == "" {
+		return DefaultLocale
+	}
+	return problem.DefaultLocale
 }
 
 //AddProblem 創建題目
@@ -29,14 +69,54 @@ func UpdateProblem(problem *Problem) (err error) {
 	return
 }
 
+// SetProblemHasTestCase 只更新題目的 has_test_case，避免覆寫其他欄位的修改
+func SetProblemHasTestCase(problemID uint, hasTestCase bool) (err error) {
+	err = DB.Model(&Problem{}).Where("id = ?", problemID).Update("has_test_case", hasTestCase).Error
+	return
+}
+
 //ListProblem 列出所有題目
 func ListProblem() (problems []Problem, err error) {
 	err = DB.Find(&problems).Error
 	return
 }
 
+// GetProblemsByAuthor 查詢 author 建立的所有題目
+func GetProblemsByAuthor(author uint) (problems []Problem, err error) {
+	err = DB.Where(&Problem{Author: author}).Order("id").Find(&problems).Error
+	return
+}
+
 //GetProblemByID 查詢題目用 problem id
 func GetProblemByID(id uint) (problem Problem, err error) {
 	err = DB.First(&problem, id).Error
 	return
 }
+
+// DeleteProblem 刪除題目，題目的資料保留到清除為止，並在同一個 transaction 中寫入操作記錄
+func DeleteProblem(id uint, log *AuditLog) (err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&Problem{}, id).Error; err != nil {
+			return err
+		}
+		return tx.Create(log).Error
+	})
+	return
+}
+
+// GetDeletedProblem 查詢已刪除的題目
+func GetDeletedProblem(id uint) (problem Problem, err error) {
+	err = DB.Unscoped().Where("deleted_at IS NOT NULL").First(&problem, id).Error
+	return
+}
+
+// RestoreProblem 還原已刪除的題目，並在同一個 transaction 中寫入操作記錄
+func RestoreProblem(id uint, log *AuditLog) (err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&Problem{}).Where("id = ?", id).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		return tx.Create(log).Error
+	})
+	return
+}
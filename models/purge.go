@@ -0,0 +1,105 @@
+package models
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// PurgeSummary 清除題目時刪除的資料筆數
+type PurgeSummary struct {
+	Samples      int64 `json:"samples"`
+	Tags         int64 `json:"tags"`
+	Languages    int64 `json:"languages"`
+	Shares       int64 `json:"shares"`
+	Permissions  int64 `json:"permissions"`
+	Translations int64 `json:"translations"`
+	Attachments  int64 `json:"attachments"`
+	Revisions    int64 `json:"revisions"`
+	Validators   int64 `json:"validators"`
+	Validations  int64 `json:"validations"`
+	References   int64 `json:"references"`
+	CustomRuns   int64 `json:"custom_runs"`
+	Submissions  int64 `json:"submissions"`
+	SubTasks     int64 `json:"sub_tasks"`
+	Wrongs       int64 `json:"wrongs"`
+	SampleChecks int64 `json:"sample_results"`
+}
+
+// errDryRun 讓試算的 transaction rollback
+var errDryRun = errors.New("dry run")
+
+// PurgeProblem 永久刪除題目與所有相關資料，submissions 為 true 時一併刪除提交
+// dryRun 為 true 時只計算會刪除的筆數，否則在同一個 transaction 中寫入 log 依刪除筆數產生的操作記錄
+// log 為 nil 時不寫入操作記錄
+func PurgeProblem(id uint, submissions, dryRun bool,
+	log func(summary PurgeSummary) (AuditLog, error)) (summary PurgeSummary, err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		for _, target := range []struct {
+			model interface{}
+			count *int64
+		}{
+			{&Sample{}, &summary.Samples},
+			{&Tag2Problem{}, &summary.Tags},
+			{&ProblemLanguage{}, &summary.Languages},
+			{&ProblemShare{}, &summary.Shares},
+			{&ProblemPermission{}, &summary.Permissions},
+			{&ProblemTranslation{}, &summary.Translations},
+			{&ProblemAttachment{}, &summary.Attachments},
+			{&ProblemRevision{}, &summary.Revisions},
+			{&Validator{}, &summary.Validators},
+			{&TestCaseValidation{}, &summary.Validations},
+			{&ReferenceSolution{}, &summary.References},
+			{&CustomRun{}, &summary.CustomRuns},
+		} {
+			result := tx.Unscoped().Where("problem_id = ?", id).Delete(target.model)
+			if result.Error != nil {
+				return result.Error
+			}
+			*target.count = result.RowsAffected
+		}
+
+		if submissions {
+			ids := tx.Unscoped().Model(&Submission{}).Select("id").Where("problem_id = ?", id)
+			for _, target := range []struct {
+				model interface{}
+				count *int64
+			}{
+				{&SubTask{}, &summary.SubTasks},
+				{&Wrong{}, &summary.Wrongs},
+				{&SampleResult{}, &summary.SampleChecks},
+			} {
+				result := tx.Unscoped().Where("submission_id IN (?)", ids).Delete(target.model)
+				if result.Error != nil {
+					return result.Error
+				}
+				*target.count = result.RowsAffected
+			}
+			result := tx.Unscoped().Where("problem_id = ?", id).Delete(&Submission{})
+			if result.Error != nil {
+				return result.Error
+			}
+			summary.Submissions = result.RowsAffected
+		}
+
+		if err := tx.Unscoped().Delete(&Problem{}, id).Error; err != nil {
+			return err
+		}
+		if dryRun {
+			return errDryRun
+		}
+		if log == nil {
+			return nil
+		}
+
+		record, err := log(summary)
+		if err != nil {
+			return err
+		}
+		return tx.Create(&record).Error
+	})
+	if err == errDryRun {
+		err = nil
+	}
+	return
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ReferenceSolution 參考解答 - database
+type ReferenceSolution struct {
+	gorm.Model
+	ProblemID    uint   `gorm:"NOT NULL;index"`
+	Author       uint   `gorm:"NOT NULL;"`
+	Language     string `gorm:"type:text;NOT NULL"`
+	SourceCode   string `gorm:"type:text;NOT NULL"`
+	Expected     string `gorm:"type:varchar(5);NOT NULL"`
+	IsMain       bool   `gorm:"NOT NULL;default:false"`
+	SubmissionID uint   // 最近一次執行的提交
+}
+
+// AddReferenceSolution 新增參考解答，若為主要解答則取消其他主要解答
+func AddReferenceSolution(solution *ReferenceSolution) (err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if solution.IsMain {
+			if err := tx.Model(&ReferenceSolution{}).
+				Where(&ReferenceSolution{ProblemID: solution.ProblemID}).
+				Update("is_main", false).Error; err != nil {
+
+				return err
+			}
+		}
+		return tx.Create(&solution).Error
+	})
+	return
+}
+
+// GetProblemReferenceSolutions 查詢 problem 所有參考解答
+func GetProblemReferenceSolutions(problemID uint) (solutions []ReferenceSolution, err error) {
+	err = DB.Where(&ReferenceSolution{ProblemID: problemID}).Order("id").Find(&solutions).Error
+	return
+}
+
+// DeleteReferenceSolution 刪除 problem 的參考解答
+func DeleteReferenceSolution(problemID, id uint) (err error) {
+	result := DB.Where(&ReferenceSolution{ProblemID: problemID}).Delete(&ReferenceSolution{}, id)
+	if err = result.Error; err == nil && result.RowsAffected == 0 {
+		err = gorm.ErrRecordNotFound
+	}
+	return
+}
+
+// RunReferenceSolution 建立參考解答的提交，不列入統計
+func RunReferenceSolution(solution *ReferenceSolution) (submission Submission, err error) {
+	now := time.Now()
+
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		submission.ProblemID = solution.ProblemID
+		submission.Author = solution.Author
+		submission.Language = solution.Language
+		submission.SourceCode = solution.SourceCode
+		submission.IsReference = true
+		submission.DispatchedAt = &now
+
+		if err := tx.Create(&submission).Error; err != nil {
+			return err
+		}
+		solution.SubmissionID = submission.ID
+		return tx.Model(solution).Update("submission_id", submission.ID).Error
+	})
+	return
+}
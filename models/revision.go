@@ -0,0 +1,123 @@
+package models
+
+import "gorm.io/gorm"
+
+// ProblemRevision 題目每次修改後的快照 - database
+type ProblemRevision struct {
+	gorm.Model
+	ProblemID    uint   `gorm:"NOT NULL;uniqueIndex:idx_problem_revision"`
+	Version      uint   `gorm:"NOT NULL;uniqueIndex:idx_problem_revision"`
+	Author       uint   `gorm:"NOT NULL"`           // 修改者
+	Snapshot     string `gorm:"type:text;NOT NULL"` // 題目、範例、tag 與語言限制的 json
+	RestoredFrom uint   // 由哪個版本還原，0 為一般修改
+}
+
+// AddProblemRevision 新增題目版本，版本號為目前最新版本加一
+// 快照與最新版本相同時不新增，回傳 added 為 false
+func AddProblemRevision(revision *ProblemRevision) (added bool, err error) {
+	err = DB.Transaction(func(tx *gorm.DB) (err error) {
+		added, err = addProblemRevision(tx, revision)
+		return
+	})
+	return
+}
+
+// addProblemRevision 在 tx 中新增題目版本
+func addProblemRevision(tx *gorm.DB, revision *ProblemRevision) (added bool, err error) {
+	var latest ProblemRevision
+
+	// 同時修改時 unique index 會讓較晚的一方失敗
+	err = tx.Where("problem_id = ?", revision.ProblemID).Order("version desc").Limit(1).Find(&latest).Error
+	if err != nil {
+		return
+	}
+	if latest.ID != 0 && latest.Snapshot == revision.Snapshot && revision.RestoredFrom == 0 {
+		return
+	}
+
+	revision.Version = latest.Version + 1
+	return true, tx.Create(revision).Error
+}
+
+// ProblemContent 題目的 tag、範例、語言限制與翻譯
+type ProblemContent struct {
+	Tags         []string
+	Samples      []Sample
+	Languages    []ProblemLanguage
+	Translations []ProblemTranslation
+}
+
+// RestoreProblemRevision 在同一個 transaction 中以 problem 與 content 取代題目目前的內容，並新增還原的版本
+func RestoreProblemRevision(problem *Problem, content *ProblemContent, revision *ProblemRevision) (err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(problem).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where(&Tag2Problem{ProblemID: problem.ID}).Delete(&Tag2Problem{}).Error; err != nil {
+			return err
+		}
+		for _, name := range content.Tags {
+			if err := tx.Where(&Tag{Name: name}).FirstOrCreate(&Tag{Name: name}).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&Tag2Problem{TagName: name, ProblemID: problem.ID}).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where(&Sample{ProblemID: problem.ID}).Delete(&Sample{}).Error; err != nil {
+			return err
+		}
+		for _, sample := range content.Samples {
+			sample.ProblemID = problem.ID
+			if err := tx.Create(&sample).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Unscoped().Where(&ProblemLanguage{ProblemID: problem.ID}).Delete(&ProblemLanguage{}).Error; err != nil {
+			return err
+		}
+		for _, language := range content.Languages {
+			language.ProblemID = problem.ID
+			if err := tx.Create(&language).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Unscoped().Where(&ProblemTranslation{ProblemID: problem.ID}).Delete(&ProblemTranslation{}).Error; err != nil {
+			return err
+		}
+		for _, translation := range content.Translations {
+			translation.ProblemID = problem.ID
+			if err := tx.Create(&translation).Error; err != nil {
+				return err
+			}
+		}
+
+		_, err := addProblemRevision(tx, revision)
+		return err
+	})
+	return
+}
+
+// GetProblemRevisions 查詢題目所有版本，依版本排序
+func GetProblemRevisions(problemID uint) (revisions []ProblemRevision, err error) {
+	err = DB.Where("problem_id = ?", problemID).Order("version").Find(&revisions).Error
+	return
+}
+
+// GetProblemRevision 查詢題目的特定版本
+func GetProblemRevision(problemID, version uint) (revision ProblemRevision, err error) {
+	err = DB.Where("problem_id = ? AND version = ?", problemID, version).First(&revision).Error
+	return
+}
+
+// HasProblemRevision 題目是否已有版本記錄
+func HasProblemRevision(problemID uint) (has bool, err error) {
+	var count int64
+
+	err = DB.Model(&ProblemRevision{}).Where("problem_id = ?", problemID).Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CustomRun 以自訂輸入執行程式的結果，不列入統計與成績 - database
+type CustomRun struct {
+	gorm.Model
+	ProblemID  uint   `gorm:"NOT NULL;index"`
+	Author     uint   `gorm:"NOT NULL;index"`
+	Language   string `gorm:"type:text;NOT NULL"`
+	SourceCode string `gorm:"type:text;NOT NULL"`
+	Input      string `gorm:"type:text"`
+	Stdout     string `gorm:"type:text"`
+	Stderr     string `gorm:"type:text"`
+	Status     int    `gorm:"NOT NULL;default:0"`
+	CPUTime    uint   `gorm:"NOT NULL;default:0"`
+	Memory     uint   `gorm:"NOT NULL;default:0"`
+	Finished   bool   `gorm:"NOT NULL;default:false"`
+}
+
+// RunResult 自訂輸入執行結果 來自 judge service
+type RunResult struct {
+	CompileError int    `json:"compile_error"`
+	Stdout       string `json:"stdout"`
+	Stderr       string `json:"stderr"`
+	CPUTime      uint   `json:"real_time"`
+	Memory       uint   `json:"memory"`
+	Status       int    `json:"result"`
+}
+
+// AddCustomRun 建立自訂輸入執行
+func AddCustomRun(run *CustomRun) (err error) {
+	err = DB.Create(&run).Error
+	return
+}
+
+// GetCustomRun 查詢自訂輸入執行
+func GetCustomRun(id uint) (run CustomRun, err error) {
+	err = DB.First(&run, id).Error
+	return
+}
+
+// UpdateCustomRunResult 更新自訂輸入執行結果，已完成的執行不會被覆蓋
+func UpdateCustomRunResult(id uint, result *RunResult) (err error) {
+	var run CustomRun
+
+	if err = DB.First(&run, id).Error; err != nil || run.Finished {
+		return
+	}
+
+	run.Stdout = result.Stdout
+	run.Stderr = result.Stderr
+	run.CPUTime = result.CPUTime
+	run.Memory = result.Memory
+	run.Status = result.Status
+	if result.CompileError == 1 {
+		run.Status = -2
+	}
+	run.Finished = true
+
+	err = DB.Save(&run).Error
+	return
+}
+
+// CountUserCustomRuns 計算使用者在 since 之後建立的自訂輸入執行數
+func CountUserCustomRuns(author uint, since time.Time) (count int64, err error) {
+	err = DB.Model(&CustomRun{}).Where("author = ? AND created_at >= ?", author, since).Count(&count).Error
+	return
+}
+
+// DeleteCustomRuns 刪除 before 之前建立的自訂輸入執行
+func DeleteCustomRuns(before time.Time) (count int64, err error) {
+	result := DB.Unscoped().Where("created_at < ?", before).Delete(&CustomRun{})
+	return result.RowsAffected, result.Error
+}
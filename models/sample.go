@@ -34,7 +34,7 @@ func AddSample(sample *Sample) (err error) {
 
 //DeleteProblemAllSamples 用 problem id 直接有這個 problem id 的範例
 func DeleteProblemAllSamples(problemID uint) (err error) {
-	err = DB.Where(&Sample{ProblemID: problemID}).Delete(Sample{}).Error
+	err = DB.Where(&Sample{ProblemID: problemID}).Delete(&Sample{}).Error
 	return
 }
 
@@ -79,3 +79,9 @@ func GetProblemAllSamplesHaveSampleID(ProblemID uint) (sample []SampleInternalDa
 	err = DB.Model(&Sample{}).Where(&Sample{ProblemID: ProblemID}).Find(&sample).Error
 	return
 }
+
+// GetProblemSortedSamples 用 problem id 找 sample，依 sort 排序
+func GetProblemSortedSamples(problemID uint) (samples []SampleData, err error) {
+	err = DB.Model(&Sample{}).Where(&Sample{ProblemID: problemID}).Order("sort").Find(&samples).Error
+	return
+}
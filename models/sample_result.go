@@ -0,0 +1,124 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SampleResult 提交在範例上的執行結果 - database
+type SampleResult struct {
+	gorm.Model
+	SubmissionID uint   `gorm:"NOT NULL;index"`
+	Sort         uint   `gorm:"NOT NULL"`
+	Status       int    `gorm:"NOT NULL"`
+	Output       string `gorm:"type:text"` // 實際輸出
+}
+
+// SampleCheckResult 範例預先檢查結果 來自 judge service
+type SampleCheckResult struct {
+	CompileError int `json:"compile_error"`
+	Results      []struct {
+		Sort   uint   `json:"sort"`
+		Output string `json:"output"`
+		Status int    `json:"result"`
+	} `json:"results"`
+}
+
+// ErrNotPrecheckFailed is returned when confirming a submission which did not fail the sample pre-check
+var ErrNotPrecheckFailed = errors.New("submission did not fail the sample pre-check")
+
+// UpdateSampleResults 更新範例預先檢查結果，通過所有範例時在同一個 transaction 中以 dispatch 將完整評測的 task 寫入 outbox
+func UpdateSampleResults(id uint, result *SampleCheckResult,
+	dispatch func(w *OutboxWriter, submission *Submission) error) (written []Outbox, err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var submission Submission
+		w := &OutboxWriter{tx: tx}
+
+		if err := tx.First(&submission, id).Error; err != nil {
+			return err
+		}
+		if submission.Precheck != PrecheckPending {
+			return ErrAlreadyRated
+		}
+
+		passed := result.CompileError == 0 && len(result.Results) > 0
+		for _, r := range result.Results {
+			sample := SampleResult{SubmissionID: id, Sort: r.Sort, Status: r.Status, Output: r.Output}
+			if err := tx.Create(&sample).Error; err != nil {
+				return err
+			}
+			if r.Status != 0 {
+				passed = false
+			}
+		}
+
+		precheck := PrecheckFailed
+		if passed {
+			precheck = PrecheckPassed
+		} else if result.CompileError == 1 {
+			// 編譯錯誤直接作為評測結果
+			return tx.Model(&submission).Updates(map[string]interface{}{
+				"precheck":        precheck,
+				"status":          -2,
+				"score":           "0.00",
+				"is_rating":       true,
+				"is_style_rating": true,
+			}).Error
+		}
+		if !passed {
+			return tx.Model(&submission).Update("precheck", precheck).Error
+		}
+
+		// 通過範例後送出完整評測
+		if err := tx.Model(&submission).Updates(map[string]interface{}{
+			"precheck":      precheck,
+			"dispatched_at": time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		if err := dispatch(w, &submission); err != nil {
+			return err
+		}
+		written = w.Written
+		return nil
+	})
+	return
+}
+
+// GetSampleResults 查詢提交在範例上的執行結果
+func GetSampleResults(submissionID uint) (results []SampleResult, err error) {
+	err = DB.Where(&SampleResult{SubmissionID: submissionID}).Order("sort").Find(&results).Error
+	return
+}
+
+// ConfirmSubmissionPrecheck 使用者確認送出未通過範例的提交，並在同一個 transaction 中以 dispatch 將完整評測的 task 寫入 outbox
+func ConfirmSubmissionPrecheck(id uint,
+	dispatch func(w *OutboxWriter, submission *Submission) error) (written []Outbox, err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var submission Submission
+		w := &OutboxWriter{tx: tx}
+
+		result := tx.Model(&Submission{}).Where("id = ? AND precheck = ? AND is_rating = ?", id, PrecheckFailed, false).
+			Updates(map[string]interface{}{
+				"precheck":      PrecheckConfirmed,
+				"dispatched_at": time.Now(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotPrecheckFailed
+		}
+		if err := tx.First(&submission, id).Error; err != nil {
+			return err
+		}
+		if err := dispatch(w, &submission); err != nil {
+			return err
+		}
+		written = w.Written
+		return nil
+	})
+	return
+}
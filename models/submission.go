@@ -1,7 +1,9 @@
 package models
 
 import (
+	"errors"
 	"strconv"
+	"time"
 
 	"github.com/NCNUCodeOJ/BackendQuestionDatabase/pkg"
 	"gorm.io/gorm"
@@ -10,18 +12,36 @@ import (
 // Submission Database - database
 type Submission struct {
 	gorm.Model
-	ProblemID     uint   `gorm:"NOT NULL;"`
-	Author        uint   `gorm:"NOT NULL;"`
-	Language      string `gorm:"type:text;NOT NULL"`
-	SourceCode    string `gorm:"type:text;NOT NULL"`
-	Status        int    `gorm:"NOT NULL"`
-	CPUTime       uint   `gorm:"NOT NULL"`
-	Memory        uint   `gorm:"NOT NULL"`
-	Score         string `gorm:"type:char(5);NOT NULL"`
-	IsRating      bool   `gorm:"type:boolean;default:false"`
-	IsStyleRating bool   `gorm:"type:boolean;default:false"`
+	ProblemID     uint       `gorm:"NOT NULL;"`
+	Author        uint       `gorm:"NOT NULL;"`
+	Language      string     `gorm:"type:text;NOT NULL"`
+	SourceCode    string     `gorm:"type:text;NOT NULL"`
+	Status        int        `gorm:"NOT NULL"`
+	CPUTime       uint       `gorm:"NOT NULL"`
+	Memory        uint       `gorm:"NOT NULL"`
+	Score         string     `gorm:"type:char(5);NOT NULL"`
+	IsRating      bool       `gorm:"type:boolean;default:false"`
+	IsStyleRating bool       `gorm:"type:boolean;default:false"`
+	IsReference   bool       `gorm:"type:boolean;default:false"`           // 參考解答的提交，不列入統計
+	Rejudged      bool       `gorm:"type:boolean;default:false"`           // 重新評測的提交，與參考解答使用 rejudge lane
+	Attempts      uint       `gorm:"NOT NULL;default:0"`                   // 因逾時重新送出評測的次數
+	ContestID     uint       `gorm:"NOT NULL;default:0"`                   // 競賽中的提交，優先評測
+	JudgedAt      *time.Time `gorm:"index"`                                // 收到評測結果的時間
+	Precheck      string     `gorm:"type:varchar(10);NOT NULL;default:''"` // 範例預先檢查的狀態
+	DispatchedAt  *time.Time `gorm:"index"`                                // 最後送出評測的時間
 }
 
+// 範例預先檢查的狀態，未預先檢查的提交為空字串
+const (
+	PrecheckPending   = "pending"   // 範例執行中
+	PrecheckPassed    = "passed"    // 範例皆通過，已送出完整評測
+	PrecheckFailed    = "failed"    // 範例未通過，等待使用者確認
+	PrecheckConfirmed = "confirmed" // 使用者確認後送出完整評測
+)
+
+// ErrAlreadyRated 提交已經有評測結果
+var ErrAlreadyRated = errors.New("submission already rated")
+
 // SubTask 子任務
 type SubTask struct {
 	gorm.Model
@@ -80,6 +100,7 @@ type SubmissionStatus struct {
 	CPUTime      uint   `json:"cpu_time"`
 	Memory       uint   `json:"memory"`
 	Score        string `json:"score"`
+	IsRating     bool   `json:"is_rating"`
 	Wrong        []wrongResultsTemplate
 	TestCase     []subTaskResult
 }
@@ -121,6 +142,7 @@ func GetSubmissionByID(id uint) (status SubmissionStatus, err error) {
 	status.CPUTime = submission.CPUTime
 	status.Memory = submission.Memory
 	status.Score = submission.Score
+	status.IsRating = submission.IsRating
 	for _, w := range wrongs {
 		var wrong wrongResultsTemplate
 		wrong.Line = strconv.Itoa(int(w.Line))
@@ -142,82 +164,128 @@ func GetSubmissionByID(id uint) (status SubmissionStatus, err error) {
 }
 
 //CreateSubmission 創建提交
-func CreateSubmission(submission *Submission) (err error) {
-	err = DB.Create(&submission).Error
+// 並在同一個 transaction 中以 dispatch 將 task 寫入 outbox
+func CreateSubmission(submission *Submission, dispatch func(w *OutboxWriter) error) (written []Outbox, err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		w := &OutboxWriter{tx: tx}
+		now := time.Now()
+
+		submission.DispatchedAt = &now
+		if err := tx.Create(&submission).Error; err != nil {
+			return err
+		}
+		if err := dispatch(w); err != nil {
+			return err
+		}
+		written = w.Written
+		return nil
+	})
 	return
 }
 
 // UpdateSubmissionJudgeResult 更新提交 - judge service
-func UpdateSubmissionJudgeResult(id uint, result *SubmissionResult) (lang, code string, status int, err error) {
-	var submission Submission
+// 以 is_rating = false 為條件搶先標記提交已評測，同時收到的重複結果只有一個會寫入
+// 在同一個 transaction 中以 dispatch 將 style 檢查寫入 outbox，dispatch 回傳的 style 結果直接寫入提交
+func UpdateSubmissionJudgeResult(id uint, result *SubmissionResult,
+	dispatch func(w *OutboxWriter, submission *Submission) (*StyleResult, error)) (written []Outbox, err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var submission Submission
+		w := &OutboxWriter{tx: tx}
+
+		if err := tx.First(&submission, id).Error; err != nil {
+			return err
+		}
 
-	if err = DB.First(&submission, id).Error; err != nil {
-		return
-	}
+		if result.CompileError == 1 {
+			submission.Status = -2
+		} else {
+			for _, v := range result.SubResults {
+				if v.Status != 0 && submission.Status != -1 {
+					submission.Status = v.Status
+				}
+				submission.CPUTime = pkg.Max(submission.CPUTime, v.CPUTime)
+				submission.Memory = pkg.Max(submission.Memory, v.Memory)
+			}
+		}
 
-	if submission.IsRating == true {
-		return
-	}
+		claim := tx.Model(&Submission{}).Where("id = ? AND is_rating = ?", id, false).Updates(map[string]interface{}{
+			"status":    submission.Status,
+			"cpu_time":  submission.CPUTime,
+			"memory":    submission.Memory,
+			"is_rating": true,
+			"judged_at": time.Now(),
+		})
+		if claim.Error != nil {
+			return claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			return ErrAlreadyRated
+		}
 
-	if result.CompileError == 1 {
-		submission.Status = -2
-	} else {
-		for _, v := range result.SubResults {
-			var subTask SubTask
-
-			subTask.CPUTime = v.CPUTime
-			subTask.Memory = v.Memory
-			subTask.Status = v.Status
-			subTask.TestCase = v.TestCase
-			subTask.SubmissionID = id
-			if err = DB.Create(&subTask).Error; err != nil {
-				return
+		if result.CompileError != 1 {
+			for _, v := range result.SubResults {
+				subTask := SubTask{
+					SubmissionID: id,
+					TestCase:     v.TestCase,
+					Status:       v.Status,
+					CPUTime:      v.CPUTime,
+					Memory:       v.Memory,
+				}
+				if err := tx.Create(&subTask).Error; err != nil {
+					return err
+				}
 			}
+		}
 
-			if v.Status != 0 && submission.Status != -1 {
-				submission.Status = v.Status
+		style, err := dispatch(w, &submission)
+		if err != nil {
+			return err
+		}
+		if style != nil {
+			if err := updateStyleResult(tx, id, style); err != nil {
+				return err
 			}
-			submission.CPUTime = pkg.Max(submission.CPUTime, v.CPUTime)
-			submission.Memory = pkg.Max(submission.Memory, v.Memory)
 		}
-	}
-
-	submission.IsRating = true
-
-	err = DB.Save(&submission).Error
-
-	lang = submission.Language
-	code = submission.SourceCode
-	status = submission.Status
-
+		written = w.Written
+		return nil
+	})
 	return
 }
 
 // UpdateSubmissionStyleResult 更新提交 - style service
+// 以 is_style_rating = false 為條件搶先標記，錯誤的結果不會留下部分的 Wrong
 func UpdateSubmissionStyleResult(id uint, result *StyleResult) (err error) {
-	var submission Submission
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		return updateStyleResult(tx, id, result)
+	})
+	return
+}
 
-	if err = DB.First(&submission, id).Error; err != nil {
-		return
+// updateStyleResult 在 tx 中寫入 style 結果，提交已有 style 結果時不處理
+func updateStyleResult(tx *gorm.DB, id uint, result *StyleResult) error {
+	claim := tx.Model(&Submission{}).Where("id = ? AND is_style_rating = ?", id, false).Updates(map[string]interface{}{
+		"score":           result.Score,
+		"is_style_rating": true,
+	})
+	if claim.Error != nil {
+		return claim.Error
 	}
-
-	if submission.IsStyleRating == true {
-		return
+	if claim.RowsAffected == 0 {
+		return tx.First(&Submission{}, id).Error
 	}
 
-	submission.Score = result.Score
-
 	for _, v := range result.WrongResults {
 		var wrong Wrong
 		var tmp int
+		var err error
 
 		if tmp, err = strconv.Atoi(v.Col); err != nil {
-			return
+			return err
 		}
 		wrong.Col = uint(tmp)
 
 		if tmp, err = strconv.Atoi(v.Line); err != nil {
-			return
+			return err
 		}
 		wrong.Line = uint(tmp)
 
@@ -225,14 +293,90 @@ func UpdateSubmissionStyleResult(id uint, result *StyleResult) (err error) {
 		wrong.Rule = v.Rule
 		wrong.SubmissionID = id
 
-		if err = DB.Create(&wrong).Error; err != nil {
-			return
+		if err = tx.Create(&wrong).Error; err != nil {
+			return err
 		}
 	}
+	return nil
+}
+
+// GetProblemSubmissions 用 problem id 取得所有提交，不含參考解答
+func GetProblemSubmissions(problemID uint) (submissions []Submission, err error) {
+	err = DB.Where(&Submission{ProblemID: problemID}).
+		Where("is_reference = ? AND precheck <> ?", false, PrecheckFailed).Find(&submissions).Error
+	return
+}
+
+// ResetSubmissionJudgeResult 清除提交的評測結果 - rejudge
+func ResetSubmissionJudgeResult(id uint) (err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(&SubTask{SubmissionID: id}).Delete(&SubTask{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where(&Wrong{SubmissionID: id}).Delete(&Wrong{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Submission{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"status":          0,
+			"cpu_time":        0,
+			"memory":          0,
+			"score":           "",
+			"is_rating":       false,
+			"is_style_rating": false,
+			"attempts":        0,
+			"judged_at":       nil,
+			"rejudged":        true,
+			"dispatched_at":   time.Now(),
+		}).Error
+	})
+	return
+}
 
-	submission.IsStyleRating = true
+// GetStuckSubmissions 查詢最後送出評測的時間早於 before 且仍未評測完成的提交
+// 沒有送出時間的舊提交以 updated_at 判斷
+func GetStuckSubmissions(before time.Time) (submissions []Submission, err error) {
+	err = DB.Where("is_rating = ? AND precheck <> ? AND COALESCE(dispatched_at, updated_at) < ?", false, PrecheckFailed, before).
+		Find(&submissions).Error
+	return
+}
 
-	err = DB.Save(&submission).Error
+// ClaimStuckSubmission 增加重新送出評測的次數並更新送出時間，
+// 提交已有結果或已被其他 sweeper 重新送出時 claimed 為 false
+func ClaimStuckSubmission(id uint, before time.Time) (claimed bool, err error) {
+	result := DB.Model(&Submission{}).
+		Where("id = ? AND is_rating = ? AND COALESCE(dispatched_at, updated_at) < ?", id, false, before).
+		Updates(map[string]interface{}{
+			"attempts":      gorm.Expr("attempts + ?", 1),
+			"dispatched_at": time.Now(),
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// MarkSubmissionSystemError 將提交標記為 system error 並結束評測
+func MarkSubmissionSystemError(id uint) (err error) {
+	err = DB.Model(&Submission{}).Where("id = ? AND is_rating = ?", id, false).Updates(map[string]interface{}{
+		"status":          5,
+		"score":           "0.00",
+		"is_rating":       true,
+		"is_style_rating": true,
+	}).Error
+	return
+}
+
+// GetOldestPendingSubmission 查詢等待評測最久的提交
+func GetOldestPendingSubmission() (submission Submission, err error) {
+	err = DB.Where("is_rating = ? AND precheck <> ?", false, PrecheckFailed).Order("created_at").First(&submission).Error
+	return
+}
+
+// CountJudgedSubmissions 計算 since 之後收到評測結果的提交數
+func CountJudgedSubmissions(since time.Time) (count int64, err error) {
+	err = DB.Model(&Submission{}).Where("judged_at >= ?", since).Count(&count).Error
+	return
+}
 
+// GetSubmission 查詢提交
+func GetSubmission(id uint) (submission Submission, err error) {
+	err = DB.First(&submission, id).Error
 	return
 }
@@ -1,6 +1,10 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
 
 // Tag2Problem Database
 type Tag2Problem struct {
@@ -27,7 +31,7 @@ func AddTag2Problem(problemID uint, tagName string) (err error) {
 
 //DeleteProblemAllTags 用 problem id 刪除 所有與這個problem id 有關的 row
 func DeleteProblemAllTags(problemID uint) (err error) {
-	err = DB.Where(&Tag2Problem{ProblemID: problemID}).Delete(Tag2Problem{}).Error
+	err = DB.Where(&Tag2Problem{ProblemID: problemID}).Delete(&Tag2Problem{}).Error
 	return
 }
 
@@ -58,7 +62,11 @@ func GetProblemsByTag(TagName string) (problems []Problem, err error) {
 	for _, tag2problem := range tag2problems {
 		var problem Problem
 
-		if problem, err = GetProblemByID(tag2problem.ProblemID); err != nil {
+		if problem, err = GetProblemByID(tag2problem.ProblemID); errors.Is(err, gorm.ErrRecordNotFound) {
+			// 已刪除的題目
+			err = nil
+			continue
+		} else if err != nil {
 			return
 		}
 		problems = append(problems, problem)
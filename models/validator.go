@@ -0,0 +1,142 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// Validator 測資驗證程式 - database
+type Validator struct {
+	gorm.Model
+	ProblemID  uint   `gorm:"NOT NULL;uniqueIndex"`
+	Language   string `gorm:"type:text;NOT NULL"`
+	SourceCode string `gorm:"type:text;NOT NULL"`
+}
+
+// TestCaseValidation 測資驗證結果 - database
+type TestCaseValidation struct {
+	gorm.Model
+	ProblemID uint   `gorm:"NOT NULL;index"`
+	RunID     uint   `gorm:"NOT NULL;default:0"` // 送出驗證的次數，用來捨棄舊的驗證結果
+	TestCase  string `gorm:"type:text;NOT NULL"`
+	Checked   bool   `gorm:"NOT NULL;default:false"`
+	Valid     bool   `gorm:"NOT NULL;default:false"`
+	Message   string `gorm:"type:text"`
+}
+
+// ValidationResult 驗證結果 來自 judge service
+type ValidationResult struct {
+	TestCase string `json:"test_case"`
+	Valid    bool   `json:"valid"`
+	Message  string `json:"message"`
+}
+
+// ErrStaleValidation 驗證結果不屬於 problem 目前的驗證
+var ErrStaleValidation = errors.New("validation run is outdated")
+
+// SetValidator 設定 problem 的驗證程式
+func SetValidator(validator *Validator) (err error) {
+	var old Validator
+
+	if err = DB.Where(&Validator{ProblemID: validator.ProblemID}).First(&old).Error; err != nil {
+		err = DB.Create(&validator).Error
+		return
+	}
+	err = DB.Model(&old).Updates(Validator{Language: validator.Language, SourceCode: validator.SourceCode}).Error
+	*validator = old
+	return
+}
+
+// GetValidatorByProblemID 查詢 problem 的驗證程式
+func GetValidatorByProblemID(problemID uint) (validator Validator, err error) {
+	err = DB.Where(&Validator{ProblemID: problemID}).First(&validator).Error
+	return
+}
+
+// DeleteValidator 刪除 problem 的驗證程式與驗證結果
+func DeleteValidator(problemID uint) (err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where(&Validator{ProblemID: problemID}).Delete(&Validator{}).Error; err != nil {
+			return err
+		}
+		return tx.Where(&TestCaseValidation{ProblemID: problemID}).Delete(&TestCaseValidation{}).Error
+	})
+	return
+}
+
+// ResetTestCaseValidations 清除舊的驗證結果，為 1 ~ number 的 test case 建立待驗證的紀錄，回傳這次驗證的 run id
+func ResetTestCaseValidations(problemID uint, number int) (runID uint, err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var last uint
+
+		// 包含已刪除的紀錄，刪除驗證程式後重新設定也不會重複
+		if err := tx.Unscoped().Model(&TestCaseValidation{}).Where("problem_id = ?", problemID).
+			Select("COALESCE(MAX(run_id), 0)").Scan(&last).Error; err != nil {
+			return err
+		}
+		runID = last + 1
+
+		if err := tx.Where(&TestCaseValidation{ProblemID: problemID}).Delete(&TestCaseValidation{}).Error; err != nil {
+			return err
+		}
+		for i := 1; i <= number; i++ {
+			validation := TestCaseValidation{ProblemID: problemID, RunID: runID, TestCase: strconv.Itoa(i)}
+			if err := tx.Create(&validation).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// UpdateTestCaseValidations 更新 runID 的驗證結果，回傳是否所有 test case 皆已驗證且合法
+// 驗證程式或 test case 已更新時，舊的驗證結果回傳 ErrStaleValidation
+func UpdateTestCaseValidations(problemID, runID uint, results []ValidationResult) (allValid bool, err error) {
+	var validations []TestCaseValidation
+
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var current int64
+
+		if err := tx.Model(&TestCaseValidation{}).
+			Where("problem_id = ? AND run_id = ?", problemID, runID).Count(&current).Error; err != nil {
+			return err
+		}
+		if current == 0 {
+			return ErrStaleValidation
+		}
+
+		for _, result := range results {
+			if err := tx.Model(&TestCaseValidation{}).
+				Where(&TestCaseValidation{ProblemID: problemID, RunID: runID, TestCase: result.TestCase}).
+				Updates(map[string]interface{}{
+					"checked": true,
+					"valid":   result.Valid,
+					"message": result.Message,
+				}).Error; err != nil {
+
+				return err
+			}
+		}
+		return tx.Where(&TestCaseValidation{ProblemID: problemID}).Find(&validations).Error
+	})
+	if err != nil {
+		return
+	}
+
+	allValid = len(validations) > 0
+	for _, validation := range validations {
+		if !validation.Checked || !validation.Valid {
+			allValid = false
+		}
+	}
+	return
+}
+
+// GetTestCaseValidations 查詢 problem 所有 test case 的驗證結果
+func GetTestCaseValidations(problemID uint) (validations []TestCaseValidation, err error) {
+	err = DB.Where(&TestCaseValidation{ProblemID: problemID}).Order("id").Find(&validations).Error
+	return
+}
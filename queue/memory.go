@@ -0,0 +1,146 @@
+package queue
+
+import "sync"
+
+// Memory task queue keeping messages in memory, for local development and tests
+type Memory struct {
+	mu          sync.Mutex
+	queues      map[string][][]byte
+	deadLetters map[string]string
+	handlers    map[string]Handler
+}
+
+// NewMemory create an in-memory task queue
+func NewMemory() *Memory {
+	return &Memory{
+		queues:      make(map[string][][]byte),
+		deadLetters: make(map[string]string),
+		handlers:    make(map[string]Handler),
+	}
+}
+
+// Declare creates the queue if it does not exist
+func (q *Memory) Declare(name string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.queues[name]; !ok {
+		q.queues[name] = nil
+	}
+	return nil
+}
+
+// DeclareWithDeadLetter creates the queue, rejected messages are moved to deadLetter
+func (q *Memory) DeclareWithDeadLetter(name, deadLetter string) error {
+	q.Declare(deadLetter)
+	q.Declare(name)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.deadLetters[name] = deadLetter
+	return nil
+}
+
+// Publish appends the message to the queue, consumed queues are delivered synchronously
+func (q *Memory) Publish(name string, body []byte) error {
+	q.mu.Lock()
+	q.queues[name] = append(q.queues[name], append([]byte(nil), body...))
+	q.mu.Unlock()
+
+	q.deliver(name)
+	return nil
+}
+
+// Inspect reports the pending messages of the queue, a registered handler counts as one consumer
+func (q *Memory) Inspect(name string) (info QueueInfo, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	info.Messages = len(q.queues[name])
+	if _, ok := q.handlers[name]; ok {
+		info.Consumers = 1
+	}
+	return
+}
+
+// Consume registers handler and delivers pending messages
+func (q *Memory) Consume(name string, handler Handler) error {
+	q.mu.Lock()
+	q.handlers[name] = handler
+	q.mu.Unlock()
+
+	q.deliver(name)
+	return nil
+}
+
+// deliver hands messages to the queue handler until the queue is empty or a message is requeued
+func (q *Memory) deliver(name string) {
+	for {
+		q.mu.Lock()
+		handler, ok := q.handlers[name]
+		if !ok || len(q.queues[name]) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		body := q.queues[name][0]
+		q.queues[name] = q.queues[name][1:]
+		q.mu.Unlock()
+
+		err := handler(body)
+		if err == nil {
+			continue
+		}
+
+		q.mu.Lock()
+		if IsRejected(err) {
+			if deadLetter, ok := q.deadLetters[name]; ok {
+				q.queues[deadLetter] = append(q.queues[deadLetter], body)
+			}
+			q.mu.Unlock()
+			continue
+		}
+		q.queues[name] = append([][]byte{body}, q.queues[name]...)
+		q.mu.Unlock()
+		return
+	}
+}
+
+// Pop removes and returns the oldest message of the queue
+func (q *Memory) Pop(name string) (body []byte, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.queues[name]) == 0 {
+		return nil, false
+	}
+	body = q.queues[name][0]
+	q.queues[name] = q.queues[name][1:]
+	return body, true
+}
+
+// Messages returns a copy of all pending messages of the queue
+func (q *Memory) Messages(name string) [][]byte {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return append([][]byte(nil), q.queues[name]...)
+}
+
+// Purge removes all pending messages of the queue
+func (q *Memory) Purge(name string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.queues[name] = nil
+}
+
+// Connected is always true
+func (q *Memory) Connected() bool {
+	return true
+}
+
+// Close does nothing
+func (q *Memory) Close() error {
+	return nil
+}
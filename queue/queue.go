@@ -0,0 +1,59 @@
+package queue
+
+import "errors"
+
+// Publisher sends a message to a named queue
+type Publisher interface {
+	Publish(name string, body []byte) error
+}
+
+// TaskQueue publishes tasks to named queues
+type TaskQueue interface {
+	// Declare makes sure the durable queue exists
+	Declare(name string) error
+	// DeclareWithDeadLetter makes sure the durable queue exists, rejected messages are moved to deadLetter
+	DeclareWithDeadLetter(name, deadLetter string) error
+	// Publish sends a persistent message to the queue
+	Publish(name string, body []byte) error
+	// Inspect reports the number of pending messages and consumers of the queue
+	Inspect(name string) (QueueInfo, error)
+	// Consume delivers messages of the queue to handler in the background with manual acks
+	Consume(name string, handler Handler) error
+	// Connected reports whether the connection to the broker is open
+	Connected() bool
+	// Close closes the underlying connection
+	Close() error
+}
+
+// QueueInfo state of a queue
+type QueueInfo struct {
+	Messages  int `json:"messages"`
+	Consumers int `json:"consumers"`
+}
+
+// Handler processes a message, nil acks the message, an error made by Reject moves it
+// to the dead-letter queue, any other error requeues it
+type Handler func(body []byte) error
+
+type rejectError struct {
+	err error
+}
+
+func (r *rejectError) Error() string {
+	return r.err.Error()
+}
+
+func (r *rejectError) Unwrap() error {
+	return r.err
+}
+
+// Reject marks err as permanent, the message will not be requeued
+func Reject(err error) error {
+	return &rejectError{err: err}
+}
+
+// IsRejected reports whether err is made by Reject
+func IsRejected(err error) bool {
+	var r *rejectError
+	return errors.As(err, &r)
+}
@@ -0,0 +1,157 @@
+package queue
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/isayme/go-amqp-reconnect/rabbitmq"
+	"github.com/streadway/amqp"
+)
+
+// RabbitMQ task queue backed by a RabbitMQ broker, reconnects automatically
+type RabbitMQ struct {
+	mu      sync.Mutex
+	conn    *rabbitmq.Connection
+	channel *rabbitmq.Channel
+}
+
+// NewRabbitMQ connect to the RabbitMQ broker
+func NewRabbitMQ(url string) (q *RabbitMQ, err error) {
+	q = &RabbitMQ{}
+
+	if q.conn, err = rabbitmq.Dial(url); err != nil {
+		return nil, err
+	}
+	if q.channel, err = q.conn.Channel(); err != nil {
+		q.conn.Close()
+		return nil, err
+	}
+	return
+}
+
+// Declare declares a durable queue
+func (q *RabbitMQ) Declare(name string) (err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	_, err = q.channel.QueueDeclare(
+		name,  // name
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	return
+}
+
+// DeclareWithDeadLetter declares a durable queue which dead-letters rejected messages
+// to a durable deadLetter queue by the default exchange
+func (q *RabbitMQ) DeclareWithDeadLetter(name, deadLetter string) (err error) {
+	if err = q.Declare(deadLetter); err != nil {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	_, err = q.channel.QueueDeclare(
+		name,  // name
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		amqp.Table{
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": deadLetter,
+		},
+	)
+	return
+}
+
+// Publish publishes a persistent message to the queue by the default exchange
+func (q *RabbitMQ) Publish(name string, body []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.channel.Publish(
+		"",    // exchange
+		name,  // routing key
+		false, // mandatory
+		false,
+		amqp.Publishing{
+			DeliveryMode: amqp.Persistent,
+			ContentType:  "text/json",
+			Body:         body,
+		},
+	)
+}
+
+// Inspect inspects the queue without declaring it
+func (q *RabbitMQ) Inspect(name string) (info QueueInfo, err error) {
+	var state amqp.Queue
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if state, err = q.channel.QueueInspect(name); err != nil {
+		return
+	}
+	info.Messages = state.Messages
+	info.Consumers = state.Consumers
+	return
+}
+
+// Consume consumes the queue on a new channel, one unacked message at a time
+func (q *RabbitMQ) Consume(name string, handler Handler) (err error) {
+	var channel *rabbitmq.Channel
+	var deliveries <-chan amqp.Delivery
+
+	if channel, err = q.conn.Channel(); err != nil {
+		return
+	}
+	if err = channel.Qos(1, 0, false); err != nil {
+		return
+	}
+	if deliveries, err = channel.Consume(
+		name,  // queue
+		"",    // consumer
+		false, // auto-ack
+		false, // exclusive
+		false, // no-local
+		false, // no-wait
+		nil,   // args
+	); err != nil {
+		return
+	}
+
+	go func() {
+		for d := range deliveries {
+			err := handler(d.Body)
+			switch {
+			case err == nil:
+				d.Ack(false)
+			case IsRejected(err):
+				log.Printf("queue %s: reject message: %s", name, err)
+				d.Nack(false, false)
+			default:
+				log.Printf("queue %s: requeue message: %s", name, err)
+				time.Sleep(time.Second)
+				d.Nack(false, true)
+			}
+		}
+	}()
+	return
+}
+
+// Connected reports whether the connection is open, it is closed while reconnecting
+func (q *RabbitMQ) Connected() bool {
+	return !q.conn.IsClosed()
+}
+
+// Close closes the channel and the connection
+func (q *RabbitMQ) Close() error {
+	q.channel.Close()
+	return q.conn.Close()
+}
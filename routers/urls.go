@@ -8,6 +8,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/models"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/queue"
 	"github.com/NCNUCodeOJ/BackendQuestionDatabase/views"
 	jwt "github.com/appleboy/gin-jwt/v2"
 	"github.com/gin-contrib/cors"
@@ -17,7 +19,8 @@ import (
 
 func getUserID() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id, err := strconv.Atoi(jwt.ExtractClaims(c)["id"].(string))
+		claims := jwt.ExtractClaims(c)
+		id, err := strconv.Atoi(claims["id"].(string))
 		if err != nil {
 			c.Abort()
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -25,14 +28,47 @@ func getUserID() gin.HandlerFunc {
 				"error":   err.Error(),
 			})
 		} else {
+			admin, _ := claims["admin"].(bool)
 			c.Set("userID", uint(id))
+			c.Set("admin", admin)
+			c.Set("groups", claimIDs(claims["groups"]))
+			c.Set("contests", claimIDs(claims["contests"]))
 			c.Next()
 		}
 	}
 }
 
+// claimIDs 讀取 jwt 中的 id 列表，例如使用者所屬的群組與參加的競賽
+func claimIDs(claim interface{}) (ids []uint) {
+	list, _ := claim.([]interface{})
+	for _, v := range list {
+		switch id := v.(type) {
+		case float64:
+			ids = append(ids, uint(id))
+		case string:
+			if n, err := strconv.Atoi(id); err == nil {
+				ids = append(ids, uint(n))
+			}
+		}
+	}
+	return
+}
+
+func requireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if admin, ok := jwt.ExtractClaims(c)["admin"].(bool); !ok || !admin {
+			c.Abort()
+			c.JSON(http.StatusForbidden, gin.H{
+				"message": "權限不足",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
 // SetupRouter index
-func SetupRouter() *gin.Engine {
+func SetupRouter(q queue.TaskQueue) *gin.Engine {
 	if gin.Mode() == "test" {
 		err := godotenv.Load(".env.test")
 		if err != nil {
@@ -54,9 +90,22 @@ func SetupRouter() *gin.Engine {
 	if err != nil {
 		log.Fatal("JWT Error:" + err.Error())
 	}
+	// 題目敘述中嵌入的附件由瀏覽器直接讀取，無法帶 Authorization header，另外接受 cookie 中的 jwt
+	attachmentAuthMiddleware, err := jwt.New(&jwt.GinJWTMiddleware{
+		Realm:            "NCNUOJ",
+		SigningAlgorithm: "HS512",
+		Key:              []byte(os.Getenv("SECRET_KEY")),
+		MaxRefresh:       time.Hour,
+		TimeFunc:         time.Now,
+		TokenLookup:      "header: Authorization, cookie: jwt",
+	})
+	if err != nil {
+		log.Fatal("JWT Error:" + err.Error())
+	}
 
 	privateURL := "api/private/v1"
 	r := gin.Default()
+	r.Use(views.UseTaskQueue(q))
 
 	// CORS
 	if os.Getenv("FrontendURL") != "" {
@@ -74,29 +123,118 @@ func SetupRouter() *gin.Engine {
 	r.GET("/ping", views.Pong)
 	r.MaxMultipartMemory = 8 << 20 // 8 MiB
 
+	// 題目權限，作者與管理員為 owner
+	owner := views.RequireProblemRole(models.RoleOwner)
+	editor := views.RequireProblemRole(models.RoleEditor)
+	viewer := views.RequireProblemRole(models.RoleViewer)
+
 	problem := r.Group(privateURL + "/problem")
 	problem.Use(authMiddleware.MiddlewareFunc())
 	problem.Use(getUserID())
 	{
 		// problem.GET("/tag/:tagName", views.GetProblemsByTag) // 查詢 該 tag 所有 problems
-		problem.POST("", views.CreateProblem)                      // 創建題目
-		problem.GET("/:id", views.GetProblemByID)                  // 取得題目
-		problem.PATCH("/:id", views.EditProblem)                   // 編輯題目
-		problem.POST("/:id/testcase", views.UploadProblemTestCase) // 上傳題目測試 test case
+		problem.POST("", views.CreateProblem)                                                // 創建題目
+		problem.GET("/:id", views.GetProblemByID)                                            // 取得題目
+		problem.PATCH("/:id", editor, views.EditProblem)                                     // 編輯題目
+		problem.DELETE("/:id", owner, views.DeleteProblem)                                   // 刪除題目，可還原
+		problem.POST("/:id/restore", views.RestoreProblem)                                   // 還原已刪除的題目
+		problem.POST("/:id/testcase", editor, views.UploadProblemTestCase)                   // 上傳題目測試 test case
+		problem.POST("/:id/testcase/case", editor, views.AddProblemTestCase)                 // 新增單筆 test case
+		problem.PUT("/:id/testcase/case/:case", editor, views.ReplaceProblemTestCase)        // 取代單筆 test case
+		problem.DELETE("/:id/testcase/case/:case", editor, views.DeleteProblemTestCase)      // 刪除單筆 test case
+		problem.PUT("/:id/testcase/order", editor, views.ReorderProblemTestCase)             // 重新排序 test case
+		problem.PUT("/:id/validator", editor, views.SetProblemValidator)                     // 設定測資驗證程式
+		problem.GET("/:id/validator", viewer, views.GetProblemValidator)                     // 取得測資驗證程式與結果
+		problem.DELETE("/:id/validator", editor, views.DeleteProblemValidator)               // 刪除測資驗證程式
+		problem.POST("/:id/reference", editor, views.CreateReferenceSolution)                // 新增參考解答
+		problem.GET("/:id/reference", viewer, views.ListReferenceSolutions)                  // 列出參考解答
+		problem.DELETE("/:id/reference/:solutionID", editor, views.DeleteReferenceSolution)  // 刪除參考解答
+		problem.POST("/:id/reference/run", editor, views.RunReferenceSolutions)              // 執行參考解答
+		problem.GET("/:id/reference/report", viewer, views.GetReferenceReport)               // 參考解答驗證報告
+		problem.GET("/:id/export", viewer, views.ExportProblem)                              // 匯出題目
+		problem.GET("/:id/revision", viewer, views.ListProblemRevisions)                     // 列出題目版本
+		problem.GET("/:id/revision/:version", viewer, views.GetProblemRevision)              // 取得題目特定版本
+		problem.POST("/:id/revision/:version/restore", editor, views.RestoreProblemRevision) // 還原題目至特定版本
+		problem.GET("/:id/diff", viewer, views.DiffProblemRevisions)                         // 比對題目的兩個版本
+		problem.PUT("/:id/visibility", owner, views.SetProblemVisibility)                    // 設定題目公開狀態
+		problem.GET("/:id/permission", viewer, views.ListProblemPermissions)                 // 列出題目權限
+		problem.PUT("/:id/permission/:userID", owner, views.GrantProblemPermission)          // 授予使用者題目權限
+		problem.DELETE("/:id/permission/:userID", owner, views.RevokeProblemPermission)      // 移除使用者題目權限
+		problem.GET("/:id/translation", viewer, views.ListProblemTranslations)               // 列出題目翻譯
+		problem.PUT("/:id/translation/:locale", editor, views.SetProblemTranslation)         // 新增或編輯題目翻譯
+		problem.DELETE("/:id/translation/:locale", editor, views.DeleteProblemTranslation)   // 刪除題目翻譯
+		problem.PUT("/:id/locale", editor, views.SetProblemDefaultLocale)                    // 設定題目預設語言
+		problem.POST("/:id/clone", viewer, views.CloneProblem)                               // 複製題目
+		problem.GET("/:id/attachment", viewer, views.ListProblemAttachments)                 // 列出題目附件
+		problem.POST("/:id/attachment", editor, views.UploadProblemAttachment)               // 上傳題目附件
+		problem.DELETE("/:id/attachment/:name", editor, views.DeleteProblemAttachment)       // 刪除題目附件
 
 	}
+	problemSet := r.Group(privateURL + "/problemset")
+	problemSet.Use(authMiddleware.MiddlewareFunc())
+	problemSet.Use(getUserID())
+	{
+		problemSet.GET("/export", views.ExportProblemSet)          // 匯出 tag 或 author 的所有題目
+		problemSet.POST("/import", views.ImportProblemSet)         // 匯入題目
+		problemSet.POST("/import/:format", views.ImportProblemSet) // 匯入 polygon、kattis 或 fps 格式的題目
+	}
 	privateProblem := r.Group(privateURL + "/problem")
 	privateProblem.Use(authMiddleware.MiddlewareFunc())
 	privateProblem.Use(getUserID())
 	{
 		privateProblem.POST("/:id/submission", views.CreateSubmission) // 上傳 submission
+		privateProblem.POST("/:id/run", views.CreateCustomRun)         // 以自訂輸入執行
+	}
+	attachment := r.Group(privateURL + "/problem")
+	attachment.Use(attachmentAuthMiddleware.MiddlewareFunc())
+	attachment.Use(getUserID())
+	{
+		attachment.GET("/:id/attachment/:name", views.GetProblemAttachment) // 下載題目附件
 	}
 	submission := r.Group(privateURL + "/submission")
 	{
-		submission.POST("/code", views.GetSourceCodeAndAuthor)            // 取得 submission code
-		submission.PATCH("/:id/judge", views.UpdateSubmissionJudgeResult) // 更新 submission judge result
-		submission.PATCH("/:id/style", views.UpdateSubmissionStyleResult) // 更新 submission style result
-		submission.GET("/:id", views.GetSubmissionByID)                   // 取得 submission
+		submission.POST("/code", views.GetSourceCodeAndAuthor)              // 取得 submission code
+		submission.PATCH("/:id/judge", views.UpdateSubmissionJudgeResult)   // 更新 submission judge result
+		submission.PATCH("/:id/style", views.UpdateSubmissionStyleResult)   // 更新 submission style result
+		submission.PATCH("/:id/sample", views.UpdateSubmissionSampleResult) // 更新 submission 範例預先檢查結果
+	}
+	privateSubmission := r.Group(privateURL + "/submission")
+	privateSubmission.Use(authMiddleware.MiddlewareFunc())
+	privateSubmission.Use(getUserID())
+	{
+		privateSubmission.GET("/:id", views.GetSubmissionDetail)              // 取得 submission，與 detail 相同需檢查權限
+		privateSubmission.GET("/:id/sample", views.GetSubmissionSampleResult) // 取得範例執行結果與差異
+		privateSubmission.GET("/:id/detail", views.GetSubmissionDetail)       // 提交者與有題目權限的使用者取得提交細節
+		privateSubmission.POST("/:id/confirm", views.ConfirmSubmission)       // 範例未通過時確認送出評測
+	}
+	run := r.Group(privateURL + "/run")
+	{
+		run.PATCH("/:id/result", views.UpdateCustomRunResult) // 更新自訂輸入執行結果
+	}
+	privateRun := r.Group(privateURL + "/run")
+	privateRun.Use(authMiddleware.MiddlewareFunc())
+	privateRun.Use(getUserID())
+	{
+		privateRun.GET("/:id", views.GetCustomRun) // 取得自訂輸入執行結果
+	}
+	language := r.Group(privateURL + "/language")
+	language.Use(authMiddleware.MiddlewareFunc())
+	{
+		language.GET("", views.ListLanguages) // 列出可使用的語言
+	}
+	validation := r.Group(privateURL + "/validation")
+	{
+		validation.PATCH("/:id", views.UpdateTestCaseValidation) // 更新 test case 驗證結果
+	}
+	admin := r.Group(privateURL + "/admin")
+	admin.Use(authMiddleware.MiddlewareFunc())
+	admin.Use(getUserID())
+	admin.Use(requireAdmin())
+	{
+		admin.GET("/sweeper", views.GetSweeperMetrics)       // 逾時提交重送統計
+		admin.GET("/queue", views.GetQueueStatus)            // 評測 queue 狀態與評測量
+		admin.POST("/problem/:id/purge", views.PurgeProblem) // 永久清除已刪除的題目
+		admin.GET("/audit", views.ListAuditLogs)             // 操作記錄
 	}
 	r.NoRoute(func(c *gin.Context) {
 		c.JSON(404, gin.H{"message": "Page not found"})
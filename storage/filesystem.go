@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Filesystem stores objects as files under Root
+type Filesystem struct {
+	Root string
+}
+
+// NewFilesystem create a filesystem storage
+func NewFilesystem(root string) *Filesystem {
+	return &Filesystem{Root: root}
+}
+
+func (f *Filesystem) path(key string) string {
+	return filepath.Join(f.Root, filepath.FromSlash(key))
+}
+
+// Get reads the file of the key
+func (f *Filesystem) Get(key string) (data []byte, err error) {
+	if data, err = ioutil.ReadFile(f.path(key)); os.IsNotExist(err) {
+		err = ErrNotExist
+	}
+	return
+}
+
+// Put writes the file of the key
+func (f *Filesystem) Put(key string, data []byte) (err error) {
+	if err = os.MkdirAll(filepath.Dir(f.path(key)), 0755); err != nil {
+		return
+	}
+	return ioutil.WriteFile(f.path(key), data, 0644)
+}
+
+// Replace writes files into a new directory and swaps it with the prefix directory
+func (f *Filesystem) Replace(prefix string, files map[string][]byte) (err error) {
+	var tmp string
+
+	dir := f.path(prefix)
+	if err = os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return
+	}
+	if tmp, err = ioutil.TempDir(filepath.Dir(dir), "new_"+filepath.Base(dir)+"_"); err != nil {
+		return
+	}
+	defer os.RemoveAll(tmp)
+
+	if err = os.Chmod(tmp, 0755); err != nil {
+		return
+	}
+	for name, data := range files {
+		path := filepath.Join(tmp, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return
+		}
+		if err = ioutil.WriteFile(path, data, 0644); err != nil {
+			return
+		}
+	}
+
+	if err = os.RemoveAll(dir); err != nil {
+		return
+	}
+	return os.Rename(tmp, dir)
+}
+
+// Delete removes the prefix directory or file
+func (f *Filesystem) Delete(prefix string) error {
+	return os.RemoveAll(f.path(prefix))
+}
+
+// Reference returns a file url of the prefix directory
+func (f *Filesystem) Reference(prefix string) string {
+	path, err := filepath.Abs(f.path(prefix))
+	if err != nil {
+		path = f.path(prefix)
+	}
+	return "file://" + filepath.ToSlash(path)
+}
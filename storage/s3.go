@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config S3-compatible object storage settings
+type S3Config struct {
+	Endpoint  string // e.g. http://localhost:9000
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+}
+
+// S3 stores objects in an S3-compatible bucket with path-style requests
+type S3 struct {
+	config S3Config
+	client *http.Client
+}
+
+type listBucketResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+}
+
+// NewS3 create a S3 storage
+func NewS3(config S3Config) *S3 {
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	config.Endpoint = strings.TrimRight(config.Endpoint, "/")
+	return &S3{
+		config: config,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// uriEncode encodes s as described in AWS Signature Version 4
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+
+	for _, c := range []byte(s) {
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func (s *S3) do(method, key string, query url.Values, body []byte) (res *http.Response, err error) {
+	var req *http.Request
+
+	path := "/" + s.config.Bucket
+	if key != "" {
+		path += "/" + key
+	}
+	canonicalURI := uriEncode(path, false)
+
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := make([]string, 0, len(keys))
+	for _, k := range keys {
+		params = append(params, uriEncode(k, true)+"="+uriEncode(query.Get(k), true))
+	}
+	canonicalQuery := strings.Join(params, "&")
+
+	rawURL := s.config.Endpoint + canonicalURI
+	if canonicalQuery != "" {
+		rawURL += "?" + canonicalQuery
+	}
+	if req, err = http.NewRequest(method, rawURL, bytes.NewReader(body)); err != nil {
+		return
+	}
+
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256.Sum256(body)
+	payload := hex.EncodeToString(payloadHash[:])
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payload)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		method,
+		canonicalURI,
+		canonicalQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payload,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payload,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := date + "/" + s.config.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.config.SecretKey), date)
+	signingKey = hmacSHA256(signingKey, s.config.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKey, scope, signedHeaders, signature,
+	))
+
+	return s.client.Do(req)
+}
+
+func (s *S3) request(method, key string, query url.Values, body []byte) (data []byte, err error) {
+	var res *http.Response
+
+	if res, err = s.do(method, key, query, body); err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	if data, err = ioutil.ReadAll(res.Body); err != nil {
+		return
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrNotExist
+	}
+	if res.StatusCode >= 300 {
+		return nil, fmt.Errorf("s3 %s %s: %s", method, key, res.Status)
+	}
+	return
+}
+
+func (s *S3) list(prefix string) (keys []string, err error) {
+	var token string
+
+	for {
+		var data []byte
+		var result listBucketResult
+
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		if data, err = s.request(http.MethodGet, "", query, nil); err != nil {
+			return
+		}
+		if err = xml.Unmarshal(data, &result); err != nil {
+			return
+		}
+		for _, content := range result.Contents {
+			keys = append(keys, content.Key)
+		}
+		if !result.IsTruncated {
+			return
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Get downloads the object of the key
+func (s *S3) Get(key string) ([]byte, error) {
+	return s.request(http.MethodGet, key, nil, nil)
+}
+
+// Put uploads the object of the key
+func (s *S3) Put(key string, data []byte) (err error) {
+	_, err = s.request(http.MethodPut, key, nil, data)
+	return
+}
+
+// Replace uploads files then removes objects under the prefix which are not in files.
+// It is not atomic: S3 has no rename, so until it returns, a judge host fetching
+// Reference(prefix) can see new files next to old ones, or stale files which are not
+// deleted yet. Replacing test cases while submissions of the problem are being judged
+// can therefore judge them with a mix of the old and new test cases; rejudge them afterwards.
+// If it fails, the prefix is left with the files uploaded so far and must be replaced again.
+func (s *S3) Replace(prefix string, files map[string][]byte) (err error) {
+	var keys []string
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err = s.Put(prefix+"/"+name, files[name]); err != nil {
+			return
+		}
+	}
+
+	if keys, err = s.list(prefix + "/"); err != nil {
+		return
+	}
+	for _, key := range keys {
+		if _, ok := files[strings.TrimPrefix(key, prefix+"/")]; ok {
+			continue
+		}
+		if _, err = s.request(http.MethodDelete, key, nil, nil); err != nil && err != ErrNotExist {
+			return
+		}
+	}
+	return nil
+}
+
+// Delete removes the object of the prefix and all objects under it
+func (s *S3) Delete(prefix string) (err error) {
+	var keys []string
+
+	if keys, err = s.list(prefix + "/"); err != nil {
+		return
+	}
+	for _, key := range append(keys, prefix) {
+		if _, err = s.request(http.MethodDelete, key, nil, nil); err != nil && err != ErrNotExist {
+			return
+		}
+	}
+	return nil
+}
+
+// Reference returns a s3 url of the prefix
+func (s *S3) Reference(prefix string) string {
+	return "s3://" + s.config.Bucket + "/" + prefix
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"errors"
+	"log"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joho/godotenv"
+)
+
+// Storage is a key-value store for test case files, keys are slash separated
+type Storage interface {
+	// Get reads the object of the key, returns ErrNotExist if it does not exist
+	Get(key string) ([]byte, error)
+	// Put writes the object of the key
+	Put(key string, data []byte) error
+	// Replace replaces all objects under the prefix with files, file names are relative to the prefix.
+	// It is atomic for Filesystem only; see S3.Replace for the window in which readers can see a mix
+	Replace(prefix string, files map[string][]byte) error
+	// Delete deletes the object of the prefix and all objects under it
+	Delete(prefix string) error
+	// Reference returns a reference to the prefix which judge hosts can use to fetch the content
+	Reference(prefix string) string
+}
+
+// ErrNotExist is returned when the object does not exist
+var ErrNotExist = errors.New("object does not exist")
+
+// Store test case storage
+var Store Storage
+
+// Setup select storage backend by STORAGE_DRIVER
+func Setup() {
+	var err error
+
+	if gin.Mode() == "test" {
+		err = godotenv.Load(".env.test")
+		if err != nil {
+			log.Println("Error loading .env file")
+		}
+	} else if gin.Mode() == "debug" {
+		err = godotenv.Load()
+		if err != nil {
+			log.Println("Error loading .env file")
+		}
+	}
+
+	switch os.Getenv("STORAGE_DRIVER") {
+	case "s3":
+		Store = NewS3(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		})
+	default:
+		Store = NewFilesystem(os.Getenv("TESTCASEDIR"))
+	}
+}
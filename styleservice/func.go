@@ -3,15 +3,20 @@ package styleservice
 import (
 	"encoding/json"
 	"errors"
-	"log"
-	"os"
+	"sync"
 
-	"github.com/gin-gonic/gin"
-	"github.com/isayme/go-amqp-reconnect/rabbitmq"
-	"github.com/joho/godotenv"
-	"github.com/streadway/amqp"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/queue"
 )
 
+// QueueName style task queue
+const QueueName = "program_style"
+
+// ResultQueueName style result queue, rejected results go to ResultDeadLetterName
+const ResultQueueName = "style_result"
+
+// ResultDeadLetterName dead-letter queue of malformed style results
+const ResultDeadLetterName = "style_result.dead"
+
 // StyleTask is a template for a style task
 type StyleTask struct {
 	SourceCode   string `json:"source_code"`
@@ -19,47 +24,31 @@ type StyleTask struct {
 	SubmissionID uint   `json:"submission_id"`
 }
 
-var supportedLanguage = map[string]bool{
-	"java":    true,
-	"python3": true,
-}
-var conn *rabbitmq.Connection
-var channel *rabbitmq.Channel
-var queue amqp.Queue
+var mu sync.RWMutex
+var supportedLanguage = map[string]bool{}
 
-func failOnError(err error, msg string) {
-	if err != nil {
-		log.Fatalf("%s: %s", msg, err)
+// SetLanguages replaces the supported languages, loaded from the language registry
+func SetLanguages(names []string) {
+	languages := make(map[string]bool, len(names))
+	for _, name := range names {
+		languages[name] = true
 	}
-}
 
-// Setup connect rabbitmq
-func Setup() {
-	var err error
+	mu.Lock()
+	defer mu.Unlock()
+	supportedLanguage = languages
+}
 
-	if gin.Mode() == "test" {
-		return
-	}
-	if gin.Mode() == "debug" {
-		err = godotenv.Load()
-		if err != nil {
-			log.Println("Error loading .env file")
-		}
-	}
+// supported reports whether the language is supported
+func supported(name string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return supportedLanguage[name]
+}
 
-	conn, err = rabbitmq.Dial(os.Getenv("RABBITMQ_HOST"))
-	failOnError(err, "Failed to connect to RabbitMQ")
-	channel, err = conn.Channel()
-	failOnError(err, "Failed to open a channel")
-	queue, err = channel.QueueDeclare(
-		"program_style", // name
-		true,            // durable
-		false,           // delete when unused
-		false,           // exclusive
-		false,           // no-wait
-		nil,             // arguments
-	)
-	failOnError(err, "Failed to declare a queue")
+// Setup declare the style queue
+func Setup(q queue.TaskQueue) error {
+	return q.Declare(QueueName)
 }
 
 // ErrUnsupportedLanguage is returned when the language is not supported
@@ -67,35 +56,19 @@ var ErrUnsupportedLanguage = errors.New("unsupported language")
 
 // Validate validates the style task
 func (j *StyleTask) Validate() error {
-	if _, ok := supportedLanguage[j.Language]; !ok {
+	if !supported(j.Language) {
 		return ErrUnsupportedLanguage
 	}
 	return nil
 }
 
 // Run  Run a new submission
-func (j *StyleTask) Run() (err error) {
+func (j *StyleTask) Run(q queue.Publisher) (err error) {
 	var data []byte
 
 	if data, err = json.Marshal(j); err != nil {
 		return
 	}
 
-	if gin.Mode() == "test" {
-		return
-	}
-
-	err = channel.Publish(
-		"",         // exchange
-		queue.Name, // routing key
-		false,      // mandatory
-		false,
-		amqp.Publishing{
-			DeliveryMode: amqp.Persistent,
-			ContentType:  "text/json",
-			Body:         data,
-		},
-	)
-
-	return
+	return q.Publish(QueueName, data)
 }
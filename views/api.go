@@ -2,7 +2,6 @@ package views
 
 import (
 	"bytes"
-	"crypto/md5"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -13,12 +12,13 @@ import (
 	"path/filepath"
 	"regexp"
 	"strconv"
-	"strings"
+	"time"
 
 	"github.com/NCNUCodeOJ/BackendQuestionDatabase/judgeservice"
 	"github.com/NCNUCodeOJ/BackendQuestionDatabase/models"
-	"github.com/NCNUCodeOJ/BackendQuestionDatabase/styleservice"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/storage"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/vincentinttsh/replace"
 	"github.com/vincentinttsh/zero"
 )
@@ -28,13 +28,20 @@ func CreateProblem(c *gin.Context) {
 	var problem models.Problem
 	userID := c.MustGet("userID").(uint)
 	data := problemAPIRequest{}
-	if err := c.BindJSON(&data); err != nil {
+	options := problemOptionAPIRequest{}
+	if err := c.ShouldBindBodyWith(&data, binding.JSON); err != nil {
 		fmt.Println(err.Error())
 		c.JSON(http.StatusBadRequest, gin.H{
 			"message": "未按照格式填寫或未使用json",
 		})
 		return
 	}
+	if err := c.ShouldBindBodyWith(&options, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "未按照格式填寫或未使用json",
+		})
+		return
+	}
 	if zero.IsZero(data) {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"message": "未填寫完成",
@@ -43,7 +50,9 @@ func CreateProblem(c *gin.Context) {
 	}
 
 	replace.Replace(&problem, &data)
+	setProblemOptions(&problem, &options)
 	problem.Author = userID
+	problem.Visibility = models.VisibilityDraft
 	// check program name
 	isValidProgramName := regexp.MustCompile(`^[a-zA-Z0-9]+$`).MatchString
 	if !isValidProgramName(problem.ProgramName) {
@@ -59,6 +68,12 @@ func CreateProblem(c *gin.Context) {
 		})
 		return
 	}
+	if err := checkProblemLanguages(&options); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
 	if err := models.AddProblem(&problem); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"message": "題目創建失敗",
@@ -66,6 +81,13 @@ func CreateProblem(c *gin.Context) {
 		return
 	}
 
+	if err := saveProblemLanguages(problem.ID, &options); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "題目創建失敗",
+		})
+		return
+	}
+
 	for _, tag := range data.TagsList {
 		if err := models.AddTag2Problem(problem.ID, tag); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -91,6 +113,13 @@ func CreateProblem(c *gin.Context) {
 		}
 	}
 
+	if err := recordProblemRevision(&problem, userID, 0); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "題目創建失敗-伺服器錯誤-revision",
+		})
+		return
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message":    "題目創建成功",
 		"problem_id": problem.ID,
@@ -109,10 +138,21 @@ func GetProblemByID(c *gin.Context) {
 		problemID = uint(ID)
 	}
 
-	if problem, err := models.GetProblemByID(problemID); err == nil {
+	if problem, ok := getVisibleProblem(c, problemID); ok {
 		var tags []string
 		var err error
 		var samples []models.SampleData
+		var problemLanguages []models.ProblemLanguage
+		var languages = make([]gin.H, 0)
+		var locale string
+		var locales []string
+
+		if locale, locales, err = localizeProblem(c, &problem); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"message": "題目讀取失敗",
+			})
+			return
+		}
 
 		if samples, err = models.GetProblemAllSamples(problemID); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -128,7 +168,21 @@ func GetProblemByID(c *gin.Context) {
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
+		if problemLanguages, err = models.GetProblemLanguages(problemID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"message": "題目讀取失敗",
+			})
+			return
+		}
+		for _, l := range problemLanguages {
+			languages = append(languages, gin.H{
+				"language":     l.Language,
+				"cpu_time":     l.CPUTime,
+				"memory_limit": l.MemoryLimit,
+			})
+		}
+
+		returnData := gin.H{
 			"problem_id":         problem.ID,
 			"problem_name":       problem.ProblemName,
 			"description":        problem.Description,
@@ -139,42 +193,43 @@ func GetProblemByID(c *gin.Context) {
 			"cpu_time":           problem.CPUTime,
 			"layer":              problem.Layer,
 			"has_test_case":      problem.HasTestCase,
-			"samples":            samples,
-			"tags_list":          tags,
-		})
+			"normalize": gin.H{
+				"crlf":                problem.NormalizeCRLF,
+				"bom":                 problem.NormalizeBOM,
+				"trailing_whitespace": problem.TrimTrailingSpace,
+				"final_newline":       problem.EnsureFinalNewline,
+			},
+			"languages":         languages,
+			"samples":           samples,
+			"tags_list":         tags,
+			"visibility":        problem.EffectiveVisibility(time.Now()),
+			"publish_at":        problem.PublishAt,
+			"source_problem_id": problem.SourceProblemID,
+			"locale":            locale,
+			"default_locale":    problem.StatementLocale(),
+			"locales":           locales,
+		}
+		// render=html 時另外回傳渲染並過濾後的敘述
+		if c.Query("render") == "html" {
+			rendered, err := renderStatement(&problem, locale)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"message": "題目讀取失敗",
+				})
+				return
+			}
+			returnData["rendered"] = rendered
+		}
 
-		return
+		c.JSON(http.StatusOK, returnData)
 	}
-	c.JSON(http.StatusNotFound, gin.H{
-		"message": "無此題目",
-	})
-
-	return
 }
 
-// GetSubmissionByID 讀取提交
-func GetSubmissionByID(c *gin.Context) {
-	var err error
-	var submission models.SubmissionStatus
-	var submissionID uint
+// submissionDetail 提交的程式碼、style 檢查與各 test case 的結果
+func submissionDetail(submission *models.SubmissionStatus) gin.H {
 	var wrong = make([]gin.H, 0)
 	var testcase = make([]gin.H, 0)
 
-	if ID, err := strconv.Atoi(c.Params.ByName("id")); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"message": "系統錯誤",
-		})
-	} else {
-		submissionID = uint(ID)
-	}
-
-	if submission, err = models.GetSubmissionByID(submissionID); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"message": "無此提交",
-		})
-		return
-	}
-
 	for _, w := range submission.Wrong {
 		wrong = append(wrong, gin.H{
 			"line":        w.Line,
@@ -193,7 +248,7 @@ func GetSubmissionByID(c *gin.Context) {
 		})
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	return gin.H{
 		"submission_id": submission.SubmissionID,
 		"problem_id":    submission.ProblemID,
 		"author":        submission.Author,
@@ -205,7 +260,7 @@ func GetSubmissionByID(c *gin.Context) {
 		"score":         submission.Score,
 		"wrong":         wrong,
 		"testcase":      testcase,
-	})
+	}
 }
 
 // GetProblemsByTag 讀取屬於該 tag 的題目
@@ -228,6 +283,13 @@ func GetProblemsByTag(c *gin.Context) {
 		})
 		return
 	}
+	v := currentViewer(c)
+	if problems, err = filterVisibleProblems(problems, &v); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
 
 	for _, problem := range problems {
 		returnData = append(returnData, map[string]interface{}{
@@ -258,8 +320,16 @@ func EditProblem(c *gin.Context) {
 	}
 
 	data := problemAPIRequest{}
+	options := problemOptionAPIRequest{}
 
-	if err := c.BindJSON(&data); err != nil {
+	if err := c.ShouldBindBodyWith(&data, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "未按照格式填寫或未使用json",
+			"err":     err.Error(),
+		})
+		return
+	}
+	if err := c.ShouldBindBodyWith(&options, binding.JSON); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"message": "未按照格式填寫或未使用json",
 			"err":     err.Error(),
@@ -274,7 +344,15 @@ func EditProblem(c *gin.Context) {
 		return
 	}
 
+	if err = recordBaselineRevision(&problem); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "題目編輯失敗-伺服器錯誤-revision",
+		})
+		return
+	}
+
 	replace.Replace(&problem, &data)
+	setProblemOptions(&problem, &options)
 	// check program name
 	isValidProgramName := regexp.MustCompile(`^[a-zA-Z0-9]+$`).MatchString
 	if !isValidProgramName(problem.ProgramName) {
@@ -290,7 +368,21 @@ func EditProblem(c *gin.Context) {
 		})
 		return
 	}
+	if err := checkProblemLanguages(&options); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
 	models.UpdateProblem(&problem)
+	invalidateRenderCache(problem.ID)
+
+	if err = saveProblemLanguages(problemID, &options); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "題目編輯失敗-伺服器錯誤-languages",
+		})
+		return
+	}
 
 	if data.TagsList != nil {
 		if oldTags, err = models.GetProblemAllTags(problemID); err != nil {
@@ -368,6 +460,13 @@ func EditProblem(c *gin.Context) {
 		}
 	}
 
+	if err = recordProblemRevision(&problem, c.MustGet("userID").(uint), 0); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "題目編輯失敗-伺服器錯誤-revision",
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message":    "題目修改成功",
 		"problem_id": problemID,
@@ -405,9 +504,14 @@ func UploadProblemTestCase(c *gin.Context) {
 		})
 		return
 	}
+	if file.Size > uploadSizeLimit {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"message": errFileTooLarge.Error(),
+		})
+		return
+	}
 
-	dir = filepath.Join(os.Getenv("TESTCASEDIR"), "tmp_"+strconv.Itoa(id))
-	if err = os.Mkdir(dir, 0700); err != nil {
+	if dir, err = ioutil.TempDir("", "testcase_"+strconv.Itoa(id)+"_"); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"message": "系統錯誤",
 			"error":   err.Error(),
@@ -437,95 +541,22 @@ func UploadProblemTestCase(c *gin.Context) {
 		return
 	}
 
-	var start int = 1
-
-	testCasePath := filepath.Join(os.Getenv("TESTCASEDIR"), strconv.Itoa(id))
-	if _, err := os.Stat(testCasePath); err == nil {
-		os.RemoveAll(testCasePath)
-	}
-	if err = os.Mkdir(testCasePath, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"message": "系統錯誤",
-			"error":   err.Error(),
-		})
-		return
-	}
-
-	infoData := struct {
-		TestCaseNumber int                         `json:"test_case_number"`
-		Spj            bool                        `json:"spj"`
-		TestCases      map[string]testCaseTemplate `json:"test_cases"`
-	}{}
-	infoData.Spj = false
-	infoData.TestCaseNumber = 0
-	infoData.TestCases = make(map[string]testCaseTemplate)
+	var cases []testCase
+	var info testCaseInfo
+	var normalized map[string][]string
+	var validating bool
+	var referenceRuns int
 
-	for true {
+	for start := 1; ; start++ {
 		inData, inOK := files[strconv.Itoa(start)+".in"]
 		outData, outOK := files[strconv.Itoa(start)+".out"]
 		if !inOK || !outOK {
 			break
 		}
-		infoData.TestCaseNumber++
-		var testcaseInfo testCaseTemplate
-
-		testcaseInfo.InputName = strconv.Itoa(start) + ".in"
-		testcaseInfo.OutputName = strconv.Itoa(start) + ".out"
-		testcaseInfo.InputSize = len(inData)
-		testcaseInfo.OutputSize = len(outData)
-		testcaseInfo.OutputMD5 = fmt.Sprintf("%x", md5.Sum([]byte(outData)))
-		testcaseInfo.StrippedOutputMD5 = fmt.Sprintf("%x", md5.Sum([]byte(strings.TrimSpace(outData))))
-
-		if needLog {
-			log.Printf(
-				"%s -> %s",
-				filepath.Join(dir, strconv.Itoa(start)+".in"),
-				filepath.Join(testCasePath, strconv.Itoa(start)+".in"),
-			)
-			log.Printf(
-				"%s -> %s",
-				filepath.Join(dir, strconv.Itoa(start)+".out"),
-				filepath.Join(testCasePath, strconv.Itoa(start)+".out"),
-			)
-		}
-
-		err = os.Rename(
-			filepath.Join(dir, strconv.Itoa(start)+".in"),
-			filepath.Join(testCasePath, strconv.Itoa(start)+".in"),
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"message": "server error",
-			})
-			if needLog {
-				log.Println(err.Error())
-			}
-			return
-		}
-		err = os.Rename(
-			filepath.Join(dir, strconv.Itoa(start)+".out"),
-			filepath.Join(testCasePath, strconv.Itoa(start)+".out"),
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"message": "server error",
-			})
-			if needLog {
-				log.Println(err.Error())
-			}
-			return
-		}
-
-		infoData.TestCases[strconv.Itoa(start)] = testcaseInfo
-
-		start++
+		cases = append(cases, testCase{Input: []byte(inData), Output: []byte(outData)})
 	}
 
-	infoFile, _ := json.MarshalIndent(infoData, "", " ")
-	infoFilePath := filepath.Join(testCasePath, "info")
-	err = ioutil.WriteFile(infoFilePath, infoFile, 0644)
-
-	if err != nil {
+	if info, normalized, err = saveTestCases(&problem, cases); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"message": "server error",
 			"error":   err.Error(),
@@ -533,18 +564,33 @@ func UploadProblemTestCase(c *gin.Context) {
 		return
 	}
 
-	problem.HasTestCase = true
+	if needLog {
+		log.Printf("%d test cases -> %s", info.TestCaseNumber, storage.Store.Reference(testCasePrefix(problemID)))
+	}
 
-	if err = models.UpdateProblem(&problem); err != nil {
+	if validating, err = updateTestCaseStatus(getOutbox(c), &problem, info.TestCaseNumber); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"message": "server error",
 		})
 		return
 	}
+
+	if info.TestCaseNumber > 0 {
+		if referenceRuns, err = runReferenceSolutions(getOutbox(c), &problem); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"message": "reference solution run failed",
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
 	c.JSON(http.StatusCreated, gin.H{
 		"message":          "上傳成功",
 		"problem_id":       problemID,
-		"test_case_number": infoData.TestCaseNumber,
+		"test_case_number": info.TestCaseNumber,
+		"normalized":       normalized,
+		"validating":       validating,
+		"reference_runs":   referenceRuns,
 	})
 }
 
@@ -668,11 +714,14 @@ func CreateSubmission(c *gin.Context) {
 	var problemID uint
 	var err error
 	var data submissionAPIRequest
+	var options submissionOptionAPIRequest
 	userID := c.MustGet("userID").(uint)
 
 	var judgeTask judgeservice.JudgeTask
 	var problem models.Problem
 	var submission models.Submission
+	var samples []models.SampleData
+	var ok bool
 
 	if ID, err := strconv.Atoi(c.Params.ByName("id")); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -682,10 +731,7 @@ func CreateSubmission(c *gin.Context) {
 		problemID = uint(ID)
 	}
 
-	if problem, err = models.GetProblemByID(problemID); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"message": "無此題目",
-		})
+	if problem, ok = getVisibleProblem(c, problemID); !ok {
 		return
 	}
 
@@ -696,7 +742,13 @@ func CreateSubmission(c *gin.Context) {
 		return
 	}
 
-	if err := c.BindJSON(&data); err != nil {
+	if err := c.ShouldBindBodyWith(&data, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "未按照格式填寫或未使用json",
+		})
+		return
+	}
+	if err := c.ShouldBindBodyWith(&options, binding.JSON); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"message": "未按照格式填寫或未使用json",
 		})
@@ -708,6 +760,21 @@ func CreateSubmission(c *gin.Context) {
 		})
 		return
 	}
+	// contest_id 決定評測的優先順序，只接受使用者參加且題目有分享的競賽
+	if options.ContestID != 0 {
+		v := currentViewer(c)
+		if allowed, err := contestAllowed(problem.ID, &v, options.ContestID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"message": "系統錯誤",
+			})
+			return
+		} else if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{
+				"message": "contest_id is not allowed",
+			})
+			return
+		}
+	}
 
 	replace.Replace(&judgeTask, &data)
 	if err = judgeTask.Validate(); err != nil {
@@ -716,46 +783,71 @@ func CreateSubmission(c *gin.Context) {
 		})
 		return
 	}
+	if _, allowed, err := problemLanguage(problem.ID, *data.Language); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	} else if !allowed {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "language is not allowed in this problem",
+		})
+		return
+	}
 
 	submission.Author = userID
 	submission.ProblemID = problem.ID
 	submission.Language = *data.Language
 	submission.SourceCode = *data.SourceCode
+	submission.ContestID = options.ContestID
 
-	if err = models.CreateSubmission(&submission); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"message": "系統錯誤",
-		})
-		return
+	if options.SampleFirst {
+		if samples, err = models.GetProblemSortedSamples(problem.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"message": "系統錯誤",
+			})
+			return
+		}
+		// 沒有範例的題目直接送出完整評測
+		if len(samples) > 0 {
+			submission.Precheck = models.PrecheckPending
+		}
 	}
 
-	judgeTask.ProblemID = problem.ID
-	judgeTask.ProgramName = problem.ProgramName
-	judgeTask.CPUTime = problem.CPUTime
-	judgeTask.MemoryLimit = problem.MemoryLimit
-	judgeTask.SubmissionID = submission.ID
-
-	if err = judgeTask.Run(); err != nil {
+	written, err := models.CreateSubmission(&submission, func(w *models.OutboxWriter) error {
+		if submission.Precheck == models.PrecheckPending {
+			sampleTask, err := newSampleTask(&problem, &submission, samples)
+			if err != nil {
+				return err
+			}
+			return sampleTask.Run(w)
+		}
+		if judgeTask, err = newJudgeTask(&problem, &submission); err != nil {
+			return err
+		}
+		return judgeTask.Run(w)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"message": "系統錯誤",
 		})
 		return
 	}
 
+	// 送出失敗的 task 已在 outbox 中，由 relay 重送
+	getOutbox(c).deliver(written)
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message":       "提交成功",
 		"submission_id": submission.ID,
+		"precheck":      submission.Precheck,
 	})
 }
 
 // UpdateSubmissionJudgeResult update submission judge result
 func UpdateSubmissionJudgeResult(c *gin.Context) {
 	var submissionID uint
-	var language, code string
-	var status int
-	var err error
 	var data models.SubmissionResult
-	var styleTask styleservice.StyleTask
 
 	if ID, err := strconv.Atoi(c.Params.ByName("id")); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -774,7 +866,7 @@ func UpdateSubmissionJudgeResult(c *gin.Context) {
 		return
 	}
 	// fmt.Printf("%+v\n", data)
-	if language, code, status, err = models.UpdateSubmissionJudgeResult(submissionID, &data); err != nil {
+	if err := applyJudgeResult(getOutbox(c), submissionID, &data); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"message": "system error",
 			"error":   err.Error(),
@@ -782,24 +874,6 @@ func UpdateSubmissionJudgeResult(c *gin.Context) {
 		return
 	}
 
-	styleTask.Language = language
-	styleTask.SourceCode = code
-	styleTask.SubmissionID = submissionID
-
-	if err = styleTask.Validate(); err == nil && status == 0 {
-		styleTask.Run()
-	} else {
-		var result models.StyleResult
-
-		if status == 0 {
-			result.Score = "10.00"
-		} else {
-			result.Score = "0.00"
-		}
-
-		models.UpdateSubmissionStyleResult(submissionID, &result)
-	}
-
 	c.JSON(http.StatusOK, gin.H{
 		"message": "update success",
 	})
@@ -0,0 +1,333 @@
+package views
+
+import (
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/models"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/storage"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// attachmentSizeLimit 單一附件的大小上限
+var attachmentSizeLimit int64 = 5 << 20
+
+// attachmentTotalLimit 每個題目所有附件的大小上限
+var attachmentTotalLimit int64 = 50 << 20
+
+// attachmentNamePattern 附件名稱只能包含英數字、點、底線與減號，且需有副檔名
+var attachmentNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*(\.[a-zA-Z0-9_-]+)+$`)
+
+// attachmentTypes 允許的副檔名與回傳的 Content-Type
+// svg 與 html 可以包含 script，不允許上傳
+var attachmentTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".pdf":  "application/pdf",
+	".zip":  "application/zip",
+	".txt":  "text/plain; charset=utf-8",
+	".csv":  "text/plain; charset=utf-8",
+	".in":   "text/plain; charset=utf-8",
+	".out":  "text/plain; charset=utf-8",
+}
+
+// packageAttachment 複製或匯入題目時一併建立的附件
+type packageAttachment struct {
+	name string
+	body []byte
+}
+
+// attachmentPrefix 題目附件在 storage 中的 prefix
+func attachmentPrefix(problemID uint) string {
+	return "attachment/" + strconv.Itoa(int(problemID))
+}
+
+// attachmentURL 附件的網址，可以在題目敘述中使用
+func attachmentURL(problemID uint, name string) string {
+	return fmt.Sprintf("%s/problem/%d/attachment/%s", privateBaseURL, problemID, name)
+}
+
+// attachmentContentType 檢查附件的副檔名與內容是否相符，回傳下載時的 Content-Type
+func attachmentContentType(name string, body []byte) (string, error) {
+	contentType, ok := attachmentTypes[strings.ToLower(path.Ext(name))]
+	if !ok {
+		return "", errors.New("attachment type is not allowed")
+	}
+	detected := http.DetectContentType(body)
+	if strings.HasPrefix(contentType, "text/") {
+		if !strings.HasPrefix(detected, "text/plain") {
+			return "", errors.New("attachment content is not plain text")
+		}
+	} else if contentType != detected {
+		return "", fmt.Errorf("attachment content is %s", detected)
+	}
+	return contentType, nil
+}
+
+// loadAttachments 讀取題目所有附件的內容
+func loadAttachments(problemID uint) (attachments []packageAttachment, err error) {
+	var records []models.ProblemAttachment
+
+	if records, err = models.GetProblemAttachments(problemID); err != nil {
+		return
+	}
+	for _, record := range records {
+		var body []byte
+		if body, err = storage.Store.Get(attachmentPrefix(problemID) + "/" + record.Name); err != nil {
+			return nil, fmt.Errorf("attachment %s: %v", record.Name, err)
+		}
+		attachments = append(attachments, packageAttachment{name: record.Name, body: body})
+	}
+	return
+}
+
+// checkAttachments 以上傳附件的規則檢查 problem package 中的附件
+func checkAttachments(attachments []packageAttachment) error {
+	var total int64
+	for _, attachment := range attachments {
+		if len(attachment.name) > 100 || !attachmentNamePattern.MatchString(attachment.name) {
+			return fmt.Errorf("attachment %s: name is invalid", attachment.name)
+		}
+		if int64(len(attachment.body)) > attachmentSizeLimit {
+			return fmt.Errorf("attachment %s: attachment is too large", attachment.name)
+		}
+		if _, err := attachmentContentType(attachment.name, attachment.body); err != nil {
+			return fmt.Errorf("attachment %s: %v", attachment.name, err)
+		}
+		total += int64(len(attachment.body))
+	}
+	if total > attachmentTotalLimit {
+		return errors.New("total size of attachments is too large")
+	}
+	return nil
+}
+
+// saveAttachments 建立題目的附件，作者為 userID
+func saveAttachments(problemID uint, attachments []packageAttachment, userID uint) error {
+	for _, a := range attachments {
+		contentType, err := attachmentContentType(a.name, a.body)
+		if err != nil {
+			return err
+		}
+		if err = storage.Store.Put(attachmentPrefix(problemID)+"/"+a.name, a.body); err != nil {
+			return err
+		}
+		attachment := models.ProblemAttachment{
+			ProblemID:   problemID,
+			Name:        a.name,
+			ContentType: contentType,
+			Size:        int64(len(a.body)),
+			Author:      userID,
+		}
+		if err = models.SetProblemAttachment(&attachment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachmentData 回傳的附件資料
+func attachmentData(attachment *models.ProblemAttachment) gin.H {
+	return gin.H{
+		"name":         attachment.Name,
+		"content_type": attachment.ContentType,
+		"size":         attachment.Size,
+		"url":          attachmentURL(attachment.ProblemID, attachment.Name),
+		"updated_at":   attachment.UpdatedAt,
+	}
+}
+
+// ListProblemAttachments 列出題目的附件
+func ListProblemAttachments(c *gin.Context) {
+	var returnData = make([]gin.H, 0)
+
+	id, _ := strconv.Atoi(c.Params.ByName("id"))
+	attachments, err := models.GetProblemAttachments(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+	for i := range attachments {
+		returnData = append(returnData, attachmentData(&attachments[i]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"problem_id":  id,
+		"attachments": returnData,
+	})
+}
+
+// UploadProblemAttachment 上傳題目的附件，name 未填寫時使用檔名，同名的附件會被取代
+func UploadProblemAttachment(c *gin.Context) {
+	var file *multipart.FileHeader
+	var attachments []models.ProblemAttachment
+	var body []byte
+	var err error
+	userID := c.MustGet("userID").(uint)
+
+	id, _ := strconv.Atoi(c.Params.ByName("id"))
+	problemID := uint(id)
+
+	if file, err = c.FormFile("file"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "未上傳附件",
+		})
+		return
+	}
+	name := c.PostForm("name")
+	if name == "" {
+		name = file.Filename
+	}
+	if len(name) > 100 || !attachmentNamePattern.MatchString(name) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "attachment name is invalid",
+		})
+		return
+	}
+	if body, err = readFormFile(file, attachmentSizeLimit); err != nil {
+		if errors.Is(err, errFileTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"message": "attachment is too large",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+	contentType, err := attachmentContentType(name, body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if attachments, err = models.GetProblemAttachments(problemID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+	total := int64(len(body))
+	for _, attachment := range attachments {
+		if attachment.Name != name {
+			total += attachment.Size
+		}
+	}
+	if total > attachmentTotalLimit {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"message": "題目附件總大小超過上限",
+		})
+		return
+	}
+
+	if err = storage.Store.Put(attachmentPrefix(problemID)+"/"+name, body); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "附件上傳失敗",
+		})
+		return
+	}
+	attachment := models.ProblemAttachment{
+		ProblemID:   problemID,
+		Name:        name,
+		ContentType: contentType,
+		Size:        int64(len(body)),
+		Author:      userID,
+	}
+	if err = models.SetProblemAttachment(&attachment); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	data := attachmentData(&attachment)
+	data["message"] = "附件上傳成功"
+	c.JSON(http.StatusCreated, data)
+}
+
+// DeleteProblemAttachment 刪除題目的附件
+func DeleteProblemAttachment(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Params.ByName("id"))
+	problemID := uint(id)
+	name := c.Params.ByName("name")
+
+	if err := models.DeleteProblemAttachment(problemID, name); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": "無此附件",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+	if err := storage.Store.Delete(attachmentPrefix(problemID) + "/" + name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "附件刪除失敗",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "附件刪除成功",
+		"problem_id": problemID,
+		"name":       name,
+	})
+}
+
+// GetProblemAttachment 下載題目的附件，可以看到題目的使用者才能下載
+// 已刪除的題目視為不存在，附件在清除題目時刪除
+func GetProblemAttachment(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "problem id is invalid",
+		})
+		return
+	}
+	problem, ok := getVisibleProblem(c, uint(id))
+	if !ok {
+		return
+	}
+
+	attachment, err := models.GetProblemAttachment(problem.ID, c.Params.ByName("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "無此附件",
+		})
+		return
+	}
+	body, err := storage.Store.Get(attachmentPrefix(problem.ID) + "/" + attachment.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "附件讀取失敗",
+		})
+		return
+	}
+
+	disposition := "attachment"
+	if strings.HasPrefix(attachment.ContentType, "image/") || attachment.ContentType == "application/pdf" {
+		disposition = "inline"
+	}
+	c.Header("Content-Disposition", disposition+"; filename="+attachment.Name)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Data(http.StatusOK, attachment.ContentType, body)
+}
@@ -0,0 +1,130 @@
+package views
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/models"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/vincentinttsh/replace"
+)
+
+// copyPart 未填寫的複製選項視為要複製
+func copyPart(option *bool) bool {
+	return option == nil || *option
+}
+
+// CloneProblem 複製題目為新的草稿題目，作者為使用者
+// 可以用 copy 選擇要複製的部分，並以題目欄位覆寫時間與記憶體限制等設定
+func CloneProblem(c *gin.Context) {
+	var source, problem models.Problem
+	var pkg problemPackage
+	var cases []testCase
+	var attachments []packageAttachment
+	var validating bool
+	var err error
+	data := problemAPIRequest{}
+	options := cloneAPIRequest{}
+	userID := c.MustGet("userID").(uint)
+
+	id, _ := strconv.Atoi(c.Params.ByName("id"))
+
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindBodyWith(&data, binding.JSON); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "未按照格式填寫或未使用json",
+			})
+			return
+		}
+		if err := c.ShouldBindBodyWith(&options, binding.JSON); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "未按照格式填寫或未使用json",
+			})
+			return
+		}
+	}
+
+	if source, err = models.GetProblemByID(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "無此題目",
+		})
+		return
+	}
+	if pkg, err = problemPackageData(&source); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	replace.Replace(&pkg, &data)
+	if data.Sample != nil {
+		pkg.Samples = nil
+		for _, sample := range data.Sample {
+			pkg.Samples = append(pkg.Samples, packageSample{Input: sample.Input, Output: sample.Output})
+		}
+	}
+	if data.TagsList != nil {
+		pkg.Tags = data.TagsList
+	}
+	if !copyPart(options.Copy.Samples) {
+		pkg.Samples = nil
+	}
+	if !copyPart(options.Copy.Tags) {
+		pkg.Tags = nil
+	}
+	if !copyPart(options.Copy.Languages) {
+		pkg.Languages = nil
+	}
+	if !copyPart(options.Copy.Validator) {
+		pkg.Validator = nil
+	}
+	if err = checkProblemPackage(&pkg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if copyPart(options.Copy.TestCases) {
+		if cases, err = loadTestCases(source.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"message": "系統錯誤",
+			})
+			return
+		}
+	}
+
+	if copyPart(options.Copy.Attachments) {
+		if attachments, err = loadAttachments(source.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"message": "系統錯誤",
+			})
+			return
+		}
+	}
+
+	if problem, validating, err = importProblemPackage(getOutbox(c), &pkg, cases, attachments, userID); err == nil {
+		problem.SourceProblemID = source.ID
+		if err = models.UpdateProblem(&problem); err != nil {
+			discardProblems([]uint{problem.ID})
+		}
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "題目複製失敗",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":           "題目複製成功",
+		"problem_id":        problem.ID,
+		"source_problem_id": source.ID,
+		"test_case_number":  len(cases),
+		"attachment_number": len(attachments),
+		"validating":        validating,
+	})
+}
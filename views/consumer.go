@@ -0,0 +1,128 @@
+package views
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/judgeservice"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/models"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/queue"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/styleservice"
+	"gorm.io/gorm"
+)
+
+// errNoSubmissionID is returned when a result message has no submission id
+var errNoSubmissionID = errors.New("submission_id is required")
+
+type judgeResultMessage struct {
+	Type         string `json:"type"`
+	SubmissionID uint   `json:"submission_id"`
+	RunID        uint   `json:"run_id"`
+	models.SubmissionResult
+}
+
+type sampleResultMessage struct {
+	SubmissionID uint `json:"submission_id"`
+	models.SampleCheckResult
+}
+
+type runResultMessage struct {
+	RunID uint `json:"run_id"`
+	models.RunResult
+}
+
+type styleResultMessage struct {
+	SubmissionID uint `json:"submission_id"`
+	models.StyleResult
+}
+
+// rejectMissing malformed messages and unknown submissions go to the dead-letter queue
+func rejectMissing(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return queue.Reject(err)
+	}
+	return err
+}
+
+func handleJudgeResult(outbox outboxPublisher, body []byte) error {
+	var message judgeResultMessage
+
+	if err := json.Unmarshal(body, &message); err != nil {
+		return queue.Reject(err)
+	}
+	if message.RunID != 0 {
+		return handleRunResult(body)
+	}
+	if message.SubmissionID == 0 {
+		return queue.Reject(errNoSubmissionID)
+	}
+	if message.Type == judgeservice.TaskTypeSample {
+		return handleSampleResult(outbox, body)
+	}
+	if needLog {
+		log.Println("judge result:", message.SubmissionID)
+	}
+	return rejectMissing(applyJudgeResult(outbox, message.SubmissionID, &message.SubmissionResult))
+}
+
+// handleRunResult 自訂輸入執行的結果與 judge 結果共用 result queue
+func handleRunResult(body []byte) error {
+	var message runResultMessage
+
+	if err := json.Unmarshal(body, &message); err != nil {
+		return queue.Reject(err)
+	}
+	return rejectMissing(models.UpdateCustomRunResult(message.RunID, &message.RunResult))
+}
+
+// handleSampleResult 範例預先檢查的結果與 judge 結果共用 result queue
+func handleSampleResult(outbox outboxPublisher, body []byte) error {
+	var message sampleResultMessage
+
+	if err := json.Unmarshal(body, &message); err != nil {
+		return queue.Reject(err)
+	}
+	return rejectMissing(applySampleResult(outbox, message.SubmissionID, &message.SampleCheckResult))
+}
+
+func handleStyleResult(body []byte) error {
+	var message styleResultMessage
+
+	if err := json.Unmarshal(body, &message); err != nil {
+		return queue.Reject(err)
+	}
+	if message.SubmissionID == 0 {
+		return queue.Reject(errNoSubmissionID)
+	}
+	if needLog {
+		log.Println("style result:", message.SubmissionID)
+	}
+	err := models.UpdateSubmissionStyleResult(message.SubmissionID, &message.StyleResult)
+	// line / col 不是數字
+	var numError *strconv.NumError
+	if errors.As(err, &numError) {
+		return queue.Reject(err)
+	}
+	return rejectMissing(err)
+}
+
+// StartResultConsumer consume judge and style results from the result queues,
+// workers can publish results instead of calling back the HTTP API
+func StartResultConsumer(q queue.TaskQueue) (err error) {
+	outbox := outboxPublisher{queue: q}
+
+	if err = q.DeclareWithDeadLetter(judgeservice.ResultQueueName, judgeservice.ResultDeadLetterName); err != nil {
+		return
+	}
+	if err = q.DeclareWithDeadLetter(styleservice.ResultQueueName, styleservice.ResultDeadLetterName); err != nil {
+		return
+	}
+	if err = q.Consume(judgeservice.ResultQueueName, func(body []byte) error {
+		return handleJudgeResult(outbox, body)
+	}); err != nil {
+		return
+	}
+	return q.Consume(styleservice.ResultQueueName, handleStyleResult)
+}
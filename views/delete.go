@@ -0,0 +1,271 @@
+package views
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/models"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// purgeTokenTTL 清除題目的確認 token 有效時間
+const purgeTokenTTL = 10 * time.Minute
+
+// auditLimit 查詢操作記錄的筆數上限
+const auditLimit = 100
+
+// newAuditLog 建立對題目操作的記錄，detail 會轉為 json
+func newAuditLog(userID, problemID uint, action string, detail interface{}) (log models.AuditLog, err error) {
+	log = models.AuditLog{UserID: userID, Action: action, ProblemID: problemID}
+	if detail != nil {
+		var body []byte
+		if body, err = json.Marshal(detail); err != nil {
+			return
+		}
+		log.Detail = string(body)
+	}
+	return
+}
+
+// purgeSignature 以 SECRET_KEY 簽署清除的題目、選項與到期時間
+func purgeSignature(problemID uint, submissions bool, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("SECRET_KEY")))
+	fmt.Fprintf(mac, "purge:%d:%t:%d", problemID, submissions, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newPurgeToken 產生清除題目的確認 token
+func newPurgeToken(problemID uint, submissions bool, now time.Time) (token string, expires time.Time) {
+	expires = now.Add(purgeTokenTTL)
+	token = strconv.FormatInt(expires.Unix(), 10) + "." + purgeSignature(problemID, submissions, expires.Unix())
+	return
+}
+
+// checkPurgeToken 檢查確認 token 是否為同一個題目與選項產生且尚未過期
+func checkPurgeToken(token string, problemID uint, submissions bool, now time.Time) bool {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	expires, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || now.Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(parts[1]), []byte(purgeSignature(problemID, submissions, expires)))
+}
+
+// DeleteProblem 刪除題目，刪除後可以還原
+func DeleteProblem(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+	id, _ := strconv.Atoi(c.Params.ByName("id"))
+
+	log, err := newAuditLog(userID, uint(id), models.AuditDeleteProblem, nil)
+	if err == nil {
+		err = models.DeleteProblem(uint(id), &log)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+	invalidateRenderCache(uint(id))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "題目刪除成功",
+		"problem_id": id,
+	})
+}
+
+// RestoreProblem 還原已刪除的題目，只有作者與管理員可以還原
+func RestoreProblem(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "problem id is invalid",
+		})
+		return
+	}
+	problem, err := models.GetDeletedProblem(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "無已刪除的題目",
+		})
+		return
+	}
+	v := currentViewer(c)
+	if ok, err := hasProblemRole(&problem, &v, models.RoleOwner); err != nil || !ok {
+		c.JSON(http.StatusForbidden, gin.H{
+			"message": "權限不足",
+		})
+		return
+	}
+
+	log, err := newAuditLog(userID, problem.ID, models.AuditRestoreProblem, nil)
+	if err == nil {
+		err = models.RestoreProblem(problem.ID, &log)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "題目還原成功",
+		"problem_id": problem.ID,
+	})
+}
+
+// PurgeProblem 永久刪除已刪除的題目、範例、tag、test case、附件與選擇性的提交
+// 未附上 confirm_token 時只回傳會刪除的資料與確認 token
+// 先刪除 storage 中的 test case 與附件，失敗時題目仍為已刪除的狀態，可以重新清除
+func PurgeProblem(c *gin.Context) {
+	var data struct {
+		Submissions  bool   `json:"submissions"`
+		ConfirmToken string `json:"confirm_token"`
+	}
+	userID := c.MustGet("userID").(uint)
+
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "problem id is invalid",
+		})
+		return
+	}
+	if err := c.ShouldBindBodyWith(&data, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "未按照格式填寫或未使用json",
+		})
+		return
+	}
+	problemID := uint(id)
+
+	if _, err = models.GetDeletedProblem(problemID); err != nil {
+		if _, err = models.GetProblemByID(problemID); err == nil {
+			c.JSON(http.StatusConflict, gin.H{
+				"message": "題目需先刪除才能清除",
+			})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "無此題目",
+		})
+		return
+	}
+
+	now := time.Now()
+	if data.ConfirmToken == "" {
+		summary, err := models.PurgeProblem(problemID, data.Submissions, true, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"message": "系統錯誤",
+			})
+			return
+		}
+		token, expires := newPurgeToken(problemID, data.Submissions, now)
+		c.JSON(http.StatusOK, gin.H{
+			"message":       "請以 confirm_token 確認清除",
+			"problem_id":    problemID,
+			"summary":       summary,
+			"confirm_token": token,
+			"expires_at":    expires,
+		})
+		return
+	}
+	if !checkPurgeToken(data.ConfirmToken, problemID, data.Submissions, now) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "confirm_token is invalid or expired",
+		})
+		return
+	}
+
+	if err = storage.Store.Delete(testCasePrefix(problemID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "test case 刪除失敗，請重新清除",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if err = storage.Store.Delete(attachmentPrefix(problemID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "附件刪除失敗，請重新清除",
+			"error":   err.Error(),
+		})
+		return
+	}
+	summary, err := models.PurgeProblem(problemID, data.Submissions, false,
+		func(summary models.PurgeSummary) (models.AuditLog, error) {
+			return newAuditLog(userID, problemID, models.AuditPurgeProblem, gin.H{
+				"submissions": data.Submissions,
+				"summary":     summary,
+			})
+		})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "題目清除成功",
+		"problem_id": problemID,
+		"summary":    summary,
+	})
+}
+
+// ListAuditLogs 查詢操作記錄，可用 problem_id 篩選
+func ListAuditLogs(c *gin.Context) {
+	var problemID int
+	var err error
+	var logs []models.AuditLog
+	var returnData = make([]gin.H, 0)
+
+	if q := c.Query("problem_id"); q != "" {
+		if problemID, err = strconv.Atoi(q); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "problem_id is invalid",
+			})
+			return
+		}
+	}
+	if logs, err = models.GetAuditLogs(uint(problemID), auditLimit); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	for _, log := range logs {
+		var detail interface{}
+		if log.Detail != "" {
+			json.Unmarshal([]byte(log.Detail), &detail)
+		}
+		returnData = append(returnData, gin.H{
+			"user_id":    log.UserID,
+			"action":     log.Action,
+			"problem_id": log.ProblemID,
+			"detail":     detail,
+			"created_at": log.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"logs": returnData,
+	})
+}
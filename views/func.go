@@ -2,13 +2,24 @@ package views
 
 import (
 	"archive/zip"
+	"bytes"
+	"crypto/md5"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/judgeservice"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/models"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/storage"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/styleservice"
+	"gorm.io/gorm"
 )
 
 func contains(slice []string, item string) bool {
@@ -34,6 +45,7 @@ func (tp *sampleTemplate) UnmarshalJSON(data []byte) error {
 
 func unZip(src, dst string) (map[string]string, error) {
 	files := make(map[string]string)
+	budget := newZipBudget()
 
 	zr, err := zip.OpenReader(src)
 	defer zr.Close()
@@ -55,6 +67,9 @@ func unZip(src, dst string) (map[string]string, error) {
 
 		path := filepath.Join(dst, file.Name)
 
+		if file.UncompressedSize64 > uint64(*budget) {
+			return nil, errZipTooLarge
+		}
 		fr, err := file.Open()
 		if err != nil {
 			return nil, err
@@ -67,10 +82,14 @@ func unZip(src, dst string) (map[string]string, error) {
 		}
 		defer fw.Close()
 
-		_, err = io.Copy(fw, fr)
+		n, err := io.Copy(fw, io.LimitReader(fr, int64(*budget)+1))
 		if err != nil {
 			return nil, err
 		}
+		if uint64(n) > uint64(*budget) {
+			return nil, errZipTooLarge
+		}
+		*budget -= zipBudget(n)
 
 		body, err := ioutil.ReadFile(path)
 		files[file.Name] = string(body)
@@ -78,3 +97,390 @@ func unZip(src, dst string) (map[string]string, error) {
 
 	return files, err
 }
+
+func testCasePrefix(problemID uint) string {
+	return strconv.Itoa(int(problemID))
+}
+
+// loadTestCases 讀取 problem 目前所有的 test case，依 test case 編號排序
+func loadTestCases(problemID uint) (cases []testCase, err error) {
+	var info testCaseInfo
+	var body []byte
+
+	prefix := testCasePrefix(problemID)
+	if body, err = storage.Store.Get(prefix + "/info"); err != nil {
+		if err == storage.ErrNotExist {
+			return nil, nil
+		}
+		return
+	}
+	if err = json.Unmarshal(body, &info); err != nil {
+		return
+	}
+
+	for i := 1; i <= info.TestCaseNumber; i++ {
+		tc := testCase{InputStored: true, OutputStored: true}
+		tcInfo := info.TestCases[strconv.Itoa(i)]
+
+		if tc.Input, err = storage.Store.Get(prefix + "/" + tcInfo.InputName); err != nil {
+			return
+		}
+		if tc.Output, err = storage.Store.Get(prefix + "/" + tcInfo.OutputName); err != nil {
+			return
+		}
+		cases = append(cases, tc)
+	}
+	return
+}
+
+func newTestCaseTemplate(name string, tc testCase) (tcInfo testCaseTemplate) {
+	tcInfo.InputName = name + ".in"
+	tcInfo.OutputName = name + ".out"
+	tcInfo.InputSize = len(tc.Input)
+	tcInfo.OutputSize = len(tc.Output)
+	tcInfo.OutputMD5 = fmt.Sprintf("%x", md5.Sum(tc.Output))
+	tcInfo.StrippedOutputMD5 = fmt.Sprintf("%x", md5.Sum([]byte(strings.TrimSpace(string(tc.Output)))))
+	return
+}
+
+var utf8BOM = []byte("\xEF\xBB\xBF")
+
+// normalizeTestCaseFile 依 problem 設定正規化 test case 檔案，回傳正規化後的內容與修改項目
+func normalizeTestCaseFile(problem *models.Problem, data []byte) ([]byte, []string) {
+	changes := make([]string, 0)
+
+	if problem.NormalizeBOM && bytes.HasPrefix(data, utf8BOM) {
+		data = data[len(utf8BOM):]
+		changes = append(changes, "bom")
+	}
+	if problem.NormalizeCRLF && bytes.Contains(data, []byte("\r\n")) {
+		data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+		changes = append(changes, "crlf")
+	}
+	if problem.TrimTrailingSpace {
+		lines := bytes.Split(data, []byte("\n"))
+		trimmed := false
+		for i, line := range lines {
+			// 未轉換 CRLF 時保留行尾的 \r
+			cr := bytes.HasSuffix(line, []byte("\r"))
+			t := bytes.TrimRight(line, " \t\r")
+			if cr {
+				t = append(t[:len(t):len(t)], '\r')
+			}
+			if len(t) != len(line) {
+				lines[i] = t
+				trimmed = true
+			}
+		}
+		if trimmed {
+			data = bytes.Join(lines, []byte("\n"))
+			changes = append(changes, "trailing_whitespace")
+		}
+	}
+	if problem.EnsureFinalNewline && len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data[:len(data):len(data)], '\n')
+		changes = append(changes, "final_newline")
+	}
+
+	return data, changes
+}
+
+// saveTestCases 以 cases 取代 problem 所有的 test case，正規化新上傳的檔案後重新產生 info
+// normalized 紀錄各檔案被修改的項目
+func saveTestCases(problem *models.Problem, cases []testCase) (info testCaseInfo, normalized map[string][]string, err error) {
+	var infoFile []byte
+
+	files := make(map[string][]byte, 2*len(cases)+1)
+	normalized = make(map[string][]string)
+
+	info.Spj = false
+	info.TestCaseNumber = len(cases)
+	info.TestCases = make(map[string]testCaseTemplate)
+
+	for i, tc := range cases {
+		var changes []string
+		name := strconv.Itoa(i + 1)
+
+		if !tc.InputStored {
+			if tc.Input, changes = normalizeTestCaseFile(problem, tc.Input); len(changes) > 0 {
+				normalized[name+".in"] = changes
+			}
+		}
+		if !tc.OutputStored {
+			if tc.Output, changes = normalizeTestCaseFile(problem, tc.Output); len(changes) > 0 {
+				normalized[name+".out"] = changes
+			}
+		}
+		tcInfo := newTestCaseTemplate(name, tc)
+
+		files[tcInfo.InputName] = tc.Input
+		files[tcInfo.OutputName] = tc.Output
+		info.TestCases[name] = tcInfo
+	}
+
+	if infoFile, err = json.MarshalIndent(info, "", " "); err != nil {
+		return
+	}
+	files["info"] = infoFile
+
+	err = storage.Store.Replace(testCasePrefix(problem.ID), files)
+	return
+}
+
+// readFormFile 讀取上傳的檔案，超過 limit 時回傳 errFileTooLarge
+func readFormFile(file *multipart.FileHeader, limit int64) (body []byte, err error) {
+	var f multipart.File
+
+	if file.Size > limit {
+		return nil, errFileTooLarge
+	}
+	if f, err = file.Open(); err != nil {
+		return
+	}
+	defer f.Close()
+
+	if body, err = ioutil.ReadAll(io.LimitReader(f, limit+1)); err != nil {
+		return
+	}
+	if int64(len(body)) > limit {
+		return nil, errFileTooLarge
+	}
+	return
+}
+
+// problemLanguage 查詢 problem 是否允許該語言，以及該語言另外設定的限制
+func problemLanguage(problemID uint, name string) (override models.ProblemLanguage, allowed bool, err error) {
+	var languages []models.ProblemLanguage
+
+	if languages, err = models.GetProblemLanguages(problemID); err != nil {
+		return
+	}
+	if len(languages) == 0 {
+		return override, true, nil
+	}
+	for _, language := range languages {
+		if language.Language == name {
+			return language, true, nil
+		}
+	}
+	return
+}
+
+// checkProblemLanguages 檢查 problem 允許的語言皆已啟用且限制合理
+func checkProblemLanguages(data *problemOptionAPIRequest) error {
+	if data.Languages == nil {
+		return nil
+	}
+	seen := make(map[string]bool, len(*data.Languages))
+	for _, language := range *data.Languages {
+		if !languageExists(language.Language) {
+			return fmt.Errorf("language %s is not supported", language.Language)
+		}
+		// 重複的語言會讓限制取決於資料的順序
+		if seen[language.Language] {
+			return fmt.Errorf("language %s is duplicated", language.Language)
+		}
+		seen[language.Language] = true
+		if language.MemoryLimit > 512*1024*1024 {
+			return fmt.Errorf("language %s out of max memorylimit", language.Language)
+		}
+	}
+	return nil
+}
+
+// saveProblemLanguages 儲存 problem 允許的語言，未填寫時不變更
+func saveProblemLanguages(problemID uint, data *problemOptionAPIRequest) error {
+	var languages []models.ProblemLanguage
+
+	if data.Languages == nil {
+		return nil
+	}
+	for _, language := range *data.Languages {
+		languages = append(languages, models.ProblemLanguage{
+			Language:    language.Language,
+			CPUTime:     language.CPUTime,
+			MemoryLimit: language.MemoryLimit,
+		})
+	}
+	return models.SetProblemLanguages(problemID, languages)
+}
+
+// newJudgeTask 建立提交的評測 task，problem 為該語言另外設定的限制優先
+func newJudgeTask(problem *models.Problem, submission *models.Submission) (judgeTask judgeservice.JudgeTask, err error) {
+	var override models.ProblemLanguage
+
+	judgeTask.SourceCode = submission.SourceCode
+	judgeTask.Language = submission.Language
+	judgeTask.ProblemID = problem.ID
+	judgeTask.TestCaseRef = storage.Store.Reference(testCasePrefix(problem.ID))
+	judgeTask.ProgramName = problem.ProgramName
+	judgeTask.CPUTime, judgeTask.MemoryLimit = languageLimits(submission.Language, problem.CPUTime, problem.MemoryLimit)
+	if override, _, err = problemLanguage(problem.ID, submission.Language); err != nil {
+		return
+	}
+	if override.CPUTime != 0 {
+		judgeTask.CPUTime = override.CPUTime
+	}
+	if override.MemoryLimit != 0 {
+		judgeTask.MemoryLimit = override.MemoryLimit
+	}
+	judgeTask.SubmissionID = submission.ID
+	judgeTask.Priority = submissionPriority(submission)
+	return
+}
+
+// submissionPriority 提交評測的優先順序，重新評測與參考解答使用 rejudge lane
+func submissionPriority(submission *models.Submission) int {
+	switch {
+	case submission.Rejudged || submission.IsReference:
+		return judgeservice.PriorityRejudge
+	case submission.ContestID != 0:
+		return judgeservice.PriorityContest
+	default:
+		return judgeservice.PriorityNormal
+	}
+}
+
+// rejudgeProblem 重新評測 problem 所有的提交
+func rejudgeProblem(outbox outboxPublisher, problem *models.Problem) (count int, err error) {
+	var submissions []models.Submission
+
+	if submissions, err = models.GetProblemSubmissions(problem.ID); err != nil {
+		return
+	}
+
+	for _, submission := range submissions {
+		if err = models.ResetSubmissionJudgeResult(submission.ID); err != nil {
+			return
+		}
+
+		judgeTask, err := newJudgeTask(problem, &submission)
+		if err != nil {
+			return count, err
+		}
+		judgeTask.Priority = judgeservice.PriorityRejudge
+		if err = judgeTask.Run(outbox); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return
+}
+
+func newValidateTask(problem *models.Problem, validator *models.Validator) (validateTask judgeservice.ValidateTask) {
+	validateTask.SourceCode = validator.SourceCode
+	validateTask.Language = validator.Language
+	validateTask.ProblemID = problem.ID
+	validateTask.TestCaseRef = storage.Store.Reference(testCasePrefix(problem.ID))
+	return
+}
+
+// updateTestCaseStatus test case 更新後，若有驗證程式則送出驗證，待全部通過才將 HasTestCase 設為 true
+func updateTestCaseStatus(outbox outboxPublisher, problem *models.Problem, number int) (validating bool, err error) {
+	var validator models.Validator
+	var runID uint
+
+	problem.HasTestCase = number > 0
+
+	// 沒有驗證程式時 test case 直接可用，其他錯誤不能略過驗證
+	validator, err = models.GetValidatorByProblemID(problem.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return
+	}
+	if err == nil && number > 0 {
+		if runID, err = models.ResetTestCaseValidations(problem.ID, number); err != nil {
+			return
+		}
+		validateTask := newValidateTask(problem, &validator)
+		validateTask.RunID = runID
+		if err = validateTask.Run(outbox); err != nil {
+			return
+		}
+		problem.HasTestCase = false
+		validating = true
+	}
+
+	err = models.SetProblemHasTestCase(problem.ID, problem.HasTestCase)
+	return
+}
+
+// runReferenceSolutions 以目前的 test case 執行 problem 所有的參考解答
+func runReferenceSolutions(outbox outboxPublisher, problem *models.Problem) (count int, err error) {
+	var solutions []models.ReferenceSolution
+
+	if solutions, err = models.GetProblemReferenceSolutions(problem.ID); err != nil {
+		return
+	}
+
+	for i := range solutions {
+		var submission models.Submission
+
+		if submission, err = models.RunReferenceSolution(&solutions[i]); err != nil {
+			return
+		}
+
+		judgeTask, err := newJudgeTask(problem, &submission)
+		if err != nil {
+			return count, err
+		}
+		judgeTask.Priority = judgeservice.PriorityRejudge
+		if err = judgeTask.Run(outbox); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return
+}
+
+// setProblemOptions 將選填的設定套用到 problem
+func setProblemOptions(problem *models.Problem, data *problemOptionAPIRequest) {
+	if data.Normalize != nil {
+		if data.Normalize.CRLF != nil {
+			problem.NormalizeCRLF = *data.Normalize.CRLF
+		}
+		if data.Normalize.BOM != nil {
+			problem.NormalizeBOM = *data.Normalize.BOM
+		}
+		if data.Normalize.TrailingWhitespace != nil {
+			problem.TrimTrailingSpace = *data.Normalize.TrailingWhitespace
+		}
+		if data.Normalize.FinalNewline != nil {
+			problem.EnsureFinalNewline = *data.Normalize.FinalNewline
+		}
+	}
+}
+
+// applyJudgeResult 更新評測結果並送出 style 檢查，重複的結果不會重複處理
+// 評測結果與 style 檢查的 task 在同一個 transaction 中寫入
+func applyJudgeResult(outbox outboxPublisher, submissionID uint, data *models.SubmissionResult) (err error) {
+	written, err := models.UpdateSubmissionJudgeResult(submissionID, data,
+		func(w *models.OutboxWriter, submission *models.Submission) (*models.StyleResult, error) {
+			var styleTask styleservice.StyleTask
+			var result models.StyleResult
+
+			styleTask.Language = submission.Language
+			styleTask.SourceCode = submission.SourceCode
+			styleTask.SubmissionID = submissionID
+
+			if err := styleTask.Validate(); err == nil && submission.Status == 0 {
+				return nil, styleTask.Run(w)
+			}
+
+			if submission.Status == 0 {
+				result.Score = "10.00"
+			} else {
+				result.Score = "0.00"
+			}
+			return &result, nil
+		})
+	if err != nil {
+		if err == models.ErrAlreadyRated {
+			return nil
+		}
+		return
+	}
+
+	// 送出失敗的 task 已在 outbox 中，由 relay 重送
+	outbox.deliver(written)
+	return nil
+}
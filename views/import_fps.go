@@ -0,0 +1,133 @@
+package views
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type fpsLimit struct {
+	Unit  string `xml:"unit,attr"`
+	Value string `xml:",chardata"`
+}
+
+// fpsItem FPS (Free Problem Set) 中的一題
+type fpsItem struct {
+	Title        string     `xml:"title"`
+	TimeLimit    fpsLimit   `xml:"time_limit"`
+	MemoryLimit  fpsLimit   `xml:"memory_limit"`
+	Description  string     `xml:"description"`
+	Input        string     `xml:"input"`
+	Output       string     `xml:"output"`
+	SampleInput  []string   `xml:"sample_input"`
+	SampleOutput []string   `xml:"sample_output"`
+	TestInput    []string   `xml:"test_input"`
+	TestOutput   []string   `xml:"test_output"`
+	Spj          []struct{} `xml:"spj"`
+	Img          []struct{} `xml:"img"`
+}
+
+type fpsFile struct {
+	Items []fpsItem `xml:"item"`
+}
+
+// fpsValue 將 FPS 的限制轉為數值
+func fpsValue(limit fpsLimit) float64 {
+	value, _ := strconv.ParseFloat(strings.TrimSpace(limit.Value), 64)
+	return value
+}
+
+// convertFPSItem 將 FPS 的一題轉為 importedProblem
+func convertFPSItem(item fpsItem) (problem importedProblem) {
+	problem.pkg.FormatVersion = packageFormatVersion
+	problem.pkg.ProgramName = importProgramName
+	problem.pkg.Layer = importLayer
+	problem.pkg.ProblemName = strings.TrimSpace(item.Title)
+	problem.pkg.Description = strings.TrimSpace(item.Description)
+	problem.pkg.InputDescription = strings.TrimSpace(item.Input)
+	problem.pkg.OutputDescription = strings.TrimSpace(item.Output)
+
+	// 時間預設單位為秒，記憶體預設單位為 MB
+	cpuTime := fpsValue(item.TimeLimit)
+	if !strings.EqualFold(item.TimeLimit.Unit, "ms") {
+		cpuTime *= 1000
+	}
+	problem.pkg.CPUTime = uint(math.Round(cpuTime))
+	if problem.pkg.CPUTime == 0 {
+		problem.pkg.CPUTime = importCPUTime
+	}
+	memory := fpsValue(item.MemoryLimit) * 1024
+	if !strings.EqualFold(item.MemoryLimit.Unit, "kb") {
+		memory *= 1024
+	}
+	problem.pkg.MemoryLimit = clampMemoryLimit(&problem, uint(memory))
+
+	for i := range item.SampleInput {
+		if i < len(item.SampleOutput) {
+			problem.pkg.Samples = append(problem.pkg.Samples,
+				packageSample{Input: item.SampleInput[i], Output: item.SampleOutput[i]})
+		}
+	}
+	for i := range item.TestInput {
+		if i < len(item.TestOutput) {
+			problem.cases = append(problem.cases,
+				testCase{Input: []byte(item.TestInput[i]), Output: []byte(item.TestOutput[i])})
+		}
+	}
+	if len(item.TestInput) != len(item.TestOutput) {
+		problem.unsupported = append(problem.unsupported, "test inputs without outputs are skipped")
+	}
+
+	if len(item.Spj) > 0 {
+		problem.unsupported = append(problem.unsupported, "special judge is not supported, output is compared exactly")
+	}
+	if len(item.Img) > 0 {
+		problem.unsupported = append(problem.unsupported, "embedded images are not imported")
+	}
+	return
+}
+
+// parseFPS 解析一個 FPS xml 檔
+func parseFPS(body []byte) (problems []importedProblem, err error) {
+	var f fpsFile
+
+	if err = xml.Unmarshal(body, &f); err != nil {
+		return nil, fmt.Errorf("fps: %v", err)
+	}
+	for _, item := range f.Items {
+		problems = append(problems, convertFPSItem(item))
+	}
+	return
+}
+
+// importFPS 轉換 FPS xml，也接受包含多個 xml 的 zip
+func importFPS(body []byte) (problems []importedProblem, err error) {
+	if !bytes.HasPrefix(body, []byte("PK")) {
+		problems, err = parseFPS(body)
+	} else {
+		archive, zerr := zipFiles(body)
+		if zerr != nil {
+			return nil, zerr
+		}
+		for _, name := range sortedNames(archive.files, "", ".xml") {
+			var text string
+			var list []importedProblem
+
+			if text, _, err = archive.readText(name); err != nil {
+				return
+			}
+			if list, err = parseFPS([]byte(text)); err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			problems = append(problems, list...)
+		}
+	}
+	if err == nil && len(problems) == 0 {
+		err = errors.New("fps file has no problem")
+	}
+	return
+}
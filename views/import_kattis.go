@@ -0,0 +1,155 @@
+package views
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// kattisProblem problem.yaml of a Kattis problem package
+type kattisProblem struct {
+	Name   interface{} `yaml:"name"` // 字串或以語言為 key 的 map
+	Limits struct {
+		Memory    uint    `yaml:"memory"` // MiB
+		TimeLimit float64 `yaml:"time_limit"`
+	} `yaml:"limits"`
+	Validation string      `yaml:"validation"`
+	Keywords   interface{} `yaml:"keywords"` // 以空白分隔的字串或 list
+}
+
+// kattisName 取出題目名稱，優先使用英文
+func kattisName(name interface{}) string {
+	switch v := name.(type) {
+	case string:
+		return v
+	case map[interface{}]interface{}:
+		if en, ok := v["en"].(string); ok {
+			return en
+		}
+		for _, value := range v {
+			if s, ok := value.(string); ok {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// kattisKeywords 將 keywords 轉為 tag
+func kattisKeywords(keywords interface{}) (tags []string) {
+	switch v := keywords.(type) {
+	case string:
+		tags = strings.Fields(v)
+	case []interface{}:
+		for _, keyword := range v {
+			if s, ok := keyword.(string); ok {
+				tags = append(tags, s)
+			}
+		}
+	}
+	return
+}
+
+// importKattis 轉換 Kattis problem package
+func importKattis(body []byte) (problems []importedProblem, err error) {
+	var p kattisProblem
+	var problem importedProblem
+
+	archive, err := zipFiles(body)
+	if err != nil {
+		return
+	}
+	root, ok := zipRoot(archive.files, "problem.yaml")
+	if !ok {
+		return nil, errors.New("problem.yaml not found")
+	}
+	manifest, _, err := archive.readText(root + "problem.yaml")
+	if err != nil {
+		return
+	}
+	if err = yaml.Unmarshal([]byte(manifest), &p); err != nil {
+		return nil, fmt.Errorf("problem.yaml: %v", err)
+	}
+
+	problem.pkg.FormatVersion = packageFormatVersion
+	problem.pkg.ProgramName = importProgramName
+	problem.pkg.Layer = importLayer
+	problem.pkg.ProblemName = kattisName(p.Name)
+	problem.pkg.Tags = kattisKeywords(p.Keywords)
+	problem.pkg.MemoryLimit = clampMemoryLimit(&problem, p.Limits.Memory*1024*1024)
+
+	// 時間限制在 Kattis 中由 judge 決定，package 中不一定會有
+	seconds := p.Limits.TimeLimit
+	if seconds == 0 {
+		if text, ok, _ := archive.readText(root + ".timelimit"); ok {
+			seconds, _ = strconv.ParseFloat(strings.TrimSpace(text), 64)
+		}
+	}
+	if seconds > 0 {
+		problem.pkg.CPUTime = uint(math.Round(seconds * 1000))
+	} else {
+		problem.pkg.CPUTime = importCPUTime
+		problem.unsupported = append(problem.unsupported, "time limit is not in the package, 1 second is used")
+	}
+
+	statement, ok, _ := archive.readText(root + "problem_statement/problem.en.tex")
+	if !ok {
+		statement, ok, _ = archive.readText(root + "problem_statement/problem.tex")
+	}
+	if ok {
+		var name string
+		name, problem.pkg.Description, problem.pkg.InputDescription, problem.pkg.OutputDescription =
+			splitLatexStatement(statement)
+		if problem.pkg.ProblemName == "" {
+			problem.pkg.ProblemName = name
+		}
+	} else {
+		problem.unsupported = append(problem.unsupported, "problem statement not found, statement is empty")
+	}
+
+	switch {
+	case strings.Contains(p.Validation, "interactive"):
+		problem.unsupported = append(problem.unsupported, "interactive problem is not supported")
+	case strings.HasPrefix(p.Validation, "custom"):
+		problem.unsupported = append(problem.unsupported, "output validator is not supported, output is compared exactly")
+	}
+	if len(sortedNames(archive.files, root+"input_format_validators/", "")) > 0 {
+		problem.unsupported = append(problem.unsupported, "input format validators are not imported")
+	}
+
+	// sample 同時也是 test case
+	for _, dir := range []string{"data/sample/", "data/secret/"} {
+		nested := false
+		for _, name := range sortedNames(archive.files, root+dir, ".in") {
+			var in, out string
+
+			if strings.Contains(strings.TrimPrefix(name, root+dir), "/") {
+				nested = true
+			}
+			if in, _, err = archive.readText(name); err != nil {
+				return
+			}
+			if out, ok, err = archive.readText(strings.TrimSuffix(name, ".in") + ".ans"); err != nil {
+				return
+			} else if !ok {
+				problem.unsupported = append(problem.unsupported,
+					fmt.Sprintf("%s has no answer file and is skipped", strings.TrimPrefix(name, root)))
+				continue
+			}
+
+			problem.cases = append(problem.cases, testCase{Input: []byte(in), Output: []byte(out)})
+			if dir == "data/sample/" {
+				problem.pkg.Samples = append(problem.pkg.Samples, packageSample{Input: in, Output: out})
+			}
+		}
+		if nested {
+			problem.unsupported = append(problem.unsupported, "test data groups in "+dir+" are flattened")
+		}
+	}
+
+	return []importedProblem{problem}, nil
+}
@@ -0,0 +1,159 @@
+package views
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type polygonTestset struct {
+	Name          string `xml:"name,attr"`
+	TimeLimit     uint   `xml:"time-limit"`
+	MemoryLimit   uint   `xml:"memory-limit"`
+	TestCount     int    `xml:"test-count"`
+	InputPattern  string `xml:"input-path-pattern"`
+	AnswerPattern string `xml:"answer-path-pattern"`
+	Tests         []struct {
+		Method string `xml:"method,attr"`
+		Sample bool   `xml:"sample,attr"`
+		Group  string `xml:"group,attr"`
+		Points string `xml:"points,attr"`
+	} `xml:"tests>test"`
+}
+
+// polygonProblem problem.xml of a Polygon package
+type polygonProblem struct {
+	ShortName string `xml:"short-name,attr"`
+	Names     []struct {
+		Language string `xml:"language,attr"`
+		Value    string `xml:"value,attr"`
+	} `xml:"names>name"`
+	Judging struct {
+		InputFile  string           `xml:"input-file,attr"`
+		OutputFile string           `xml:"output-file,attr"`
+		Testsets   []polygonTestset `xml:"testset"`
+	} `xml:"judging"`
+	Assets struct {
+		Checker *struct {
+			Name string `xml:"name,attr"`
+		} `xml:"checker"`
+		Interactor *struct{}  `xml:"interactor"`
+		Validators []struct{} `xml:"validators>validator"`
+	} `xml:"assets"`
+	Tags []struct {
+		Value string `xml:"value,attr"`
+	} `xml:"tags>tag"`
+}
+
+// importPolygon 轉換 Polygon package，需包含已產生的 test case
+func importPolygon(body []byte) (problems []importedProblem, err error) {
+	var p polygonProblem
+	var problem importedProblem
+	var testset *polygonTestset
+
+	archive, err := zipFiles(body)
+	if err != nil {
+		return
+	}
+	root, ok := zipRoot(archive.files, "problem.xml")
+	if !ok {
+		return nil, errors.New("problem.xml not found")
+	}
+	manifest, _, err := archive.readText(root + "problem.xml")
+	if err != nil {
+		return
+	}
+	if err = xml.Unmarshal([]byte(manifest), &p); err != nil {
+		return nil, fmt.Errorf("problem.xml: %v", err)
+	}
+
+	for i := range p.Judging.Testsets {
+		if p.Judging.Testsets[i].Name == "tests" || testset == nil {
+			testset = &p.Judging.Testsets[i]
+		}
+	}
+	if testset == nil {
+		return nil, errors.New("problem.xml has no testset")
+	}
+
+	// 題目名稱與敘述優先使用英文
+	language := "english"
+	problem.pkg.ProblemName = p.ShortName
+	for i, name := range p.Names {
+		if i == 0 || name.Language == "english" {
+			language = name.Language
+			problem.pkg.ProblemName = name.Value
+		}
+	}
+	statement := root + "statement-sections/" + language + "/"
+	if legend, ok, _ := archive.readText(statement + "legend.tex"); ok {
+		problem.pkg.Description = strings.TrimSpace(legend)
+		input, _, _ := archive.readText(statement + "input.tex")
+		output, _, _ := archive.readText(statement + "output.tex")
+		problem.pkg.InputDescription = strings.TrimSpace(input)
+		problem.pkg.OutputDescription = strings.TrimSpace(output)
+	} else {
+		problem.unsupported = append(problem.unsupported, "statement sections not found, statement is empty")
+	}
+
+	problem.pkg.FormatVersion = packageFormatVersion
+	problem.pkg.ProgramName = importProgramName
+	problem.pkg.Layer = importLayer
+	problem.pkg.CPUTime = testset.TimeLimit
+	if problem.pkg.CPUTime == 0 {
+		problem.pkg.CPUTime = importCPUTime
+	}
+	problem.pkg.MemoryLimit = clampMemoryLimit(&problem, testset.MemoryLimit)
+	for _, tag := range p.Tags {
+		problem.pkg.Tags = append(problem.pkg.Tags, tag.Value)
+	}
+
+	if p.Judging.InputFile != "" || p.Judging.OutputFile != "" {
+		problem.unsupported = append(problem.unsupported, "file input/output is not supported, standard input/output is used")
+	}
+	// testlib 的標準 checker 會忽略空白或大小寫，與逐字比對的結果不同
+	if p.Assets.Checker != nil {
+		problem.unsupported = append(problem.unsupported,
+			fmt.Sprintf("checker %s is not supported, output is compared exactly", p.Assets.Checker.Name))
+	}
+	if p.Assets.Interactor != nil {
+		problem.unsupported = append(problem.unsupported, "interactor is not supported")
+	}
+	if len(p.Assets.Validators) > 0 {
+		problem.unsupported = append(problem.unsupported, "validators are not imported")
+	}
+
+	grouped := false
+	for i, test := range testset.Tests {
+		var tc testCase
+		var in, out string
+		var inOK, outOK bool
+
+		if test.Group != "" || test.Points != "" {
+			grouped = true
+		}
+		if in, inOK, err = archive.readText(root + fmt.Sprintf(testset.InputPattern, i+1)); err != nil {
+			return
+		}
+		if out, outOK, err = archive.readText(root + fmt.Sprintf(testset.AnswerPattern, i+1)); err != nil {
+			return
+		}
+		if !inOK || !outOK {
+			problem.unsupported = append(problem.unsupported,
+				fmt.Sprintf("test %d (%s) is not in the package and is skipped", i+1, test.Method))
+			continue
+		}
+
+		tc.Input, tc.Output = []byte(in), []byte(out)
+		problem.cases = append(problem.cases, tc)
+		if test.Sample {
+			problem.pkg.Samples = append(problem.pkg.Samples, packageSample{Input: in, Output: out})
+		}
+	}
+	if grouped {
+		problem.unsupported = append(problem.unsupported, "test groups and points are ignored")
+	}
+
+	return []importedProblem{problem}, nil
+}
@@ -0,0 +1,141 @@
+package views
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// importedProblem 由 problem package 或其他系統的格式轉換而來的題目
+type importedProblem struct {
+	pkg         problemPackage
+	cases       []testCase
+	attachments []packageAttachment
+	unsupported []string // 無法轉換而被忽略的功能
+}
+
+// problemImporter 將上傳的檔案轉換為題目
+type problemImporter func(body []byte) ([]importedProblem, error)
+
+// importers 依 url 中的 format 選擇匯入的格式，空字串為本系統的 problem package
+var importers = map[string]problemImporter{
+	"":        readProblemPackages,
+	"polygon": importPolygon,
+	"kattis":  importKattis,
+	"fps":     importFPS,
+}
+
+var errNotZip = errors.New("package is not a zip file")
+
+// 匯入其他系統的題目時使用的預設值
+const (
+	importProgramName = "Main"
+	importLayer       = 1
+	importCPUTime     = 1000
+	importMemoryLimit = 256 * 1024 * 1024
+	maxMemoryLimit    = 512 * 1024 * 1024
+)
+
+// zipArchive zip 中所有的檔案，以檔名為 key，讀取的檔案共用同一個解壓縮大小的 budget
+type zipArchive struct {
+	files  map[string]*zip.File
+	budget *zipBudget
+}
+
+// zipFiles 讀取 zip 中所有的檔案
+func zipFiles(body []byte) (*zipArchive, error) {
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, errNotZip
+	}
+
+	archive := &zipArchive{files: make(map[string]*zip.File, len(zr.File)), budget: newZipBudget()}
+	for _, file := range zr.File {
+		if !file.FileInfo().IsDir() {
+			archive.files[file.Name] = file
+		}
+	}
+	return archive, nil
+}
+
+// readText 讀取 zip 中的文字檔，檔案不存在時 ok 為 false
+func (z *zipArchive) readText(name string) (text string, ok bool, err error) {
+	var body []byte
+
+	file, ok := z.files[name]
+	if !ok {
+		return
+	}
+	if body, err = readZipFile(file, z.budget); err != nil {
+		return
+	}
+	return string(body), true, nil
+}
+
+// zipRoot 找出 zip 中 marker 所在的目錄，允許整個題目被包在一層目錄中
+func zipRoot(files map[string]*zip.File, marker string) (root string, ok bool) {
+	if _, ok = files[marker]; ok {
+		return "", true
+	}
+	for name := range files {
+		if strings.HasSuffix(name, "/"+marker) && strings.Count(name, "/") == 1 {
+			return strings.TrimSuffix(name, marker), true
+		}
+	}
+	return "", false
+}
+
+// sortedNames 回傳 zip 中位於 dir 下且副檔名為 ext 的檔名，依檔名排序
+func sortedNames(files map[string]*zip.File, dir, ext string) (names []string) {
+	for name := range files {
+		if strings.HasPrefix(name, dir) && strings.HasSuffix(name, ext) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return
+}
+
+// clampMemoryLimit 記憶體限制超過上限時使用上限並記錄
+func clampMemoryLimit(problem *importedProblem, memory uint) uint {
+	if memory > maxMemoryLimit {
+		problem.unsupported = append(problem.unsupported, "memory limit is larger than 512 MiB, 512 MiB is used")
+		return maxMemoryLimit
+	}
+	if memory == 0 {
+		return importMemoryLimit
+	}
+	return memory
+}
+
+var latexSection = regexp.MustCompile(`\\section\*?\{([^}]*)\}`)
+var latexProblemName = regexp.MustCompile(`\\problemname\{([^}]*)\}`)
+
+// splitLatexStatement 將 LaTeX 題目敘述依 Input / Output 章節分為題目、輸入與輸出說明
+func splitLatexStatement(tex string) (name, description, input, output string) {
+	if m := latexProblemName.FindStringSubmatch(tex); m != nil {
+		name = m[1]
+		tex = strings.Replace(tex, m[0], "", 1)
+	}
+
+	current := &description
+	last := 0
+	for _, m := range latexSection.FindAllStringSubmatchIndex(tex, -1) {
+		*current += tex[last:m[0]]
+		switch strings.ToLower(strings.TrimSpace(tex[m[2]:m[3]])) {
+		case "input":
+			current = &input
+		case "output":
+			current = &output
+		default:
+			*current += tex[m[0]:m[1]]
+		}
+		last = m[1]
+	}
+	*current += tex[last:]
+
+	return name, strings.TrimSpace(description), strings.TrimSpace(input), strings.TrimSpace(output)
+}
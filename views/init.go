@@ -1,6 +1,10 @@
 package views
 
-import "os"
+import (
+	"log"
+	"os"
+	"strconv"
+)
 
 var needLog = false
 var userHost = os.Getenv("USER_HOST")
@@ -12,4 +16,22 @@ func Setup() {
 		needLog = true
 	}
 
+	if limit, err := strconv.Atoi(os.Getenv("CUSTOM_RUN_LIMIT")); err == nil && limit > 0 {
+		customRunLimit = int64(limit)
+	}
+	if limit, err := strconv.Atoi(os.Getenv("ATTACHMENT_SIZE_LIMIT")); err == nil && limit > 0 {
+		attachmentSizeLimit = int64(limit)
+	}
+	if limit, err := strconv.Atoi(os.Getenv("UPLOAD_SIZE_LIMIT")); err == nil && limit > 0 {
+		uploadSizeLimit = int64(limit)
+	}
+	if limit, err := strconv.Atoi(os.Getenv("ZIP_SIZE_LIMIT")); err == nil && limit > 0 {
+		zipSizeLimit = uint64(limit)
+	}
+
+	// judge service 與 style service 的語言只來自語言表，無法載入時不能接受任何提交
+	// 之後由 StartLanguageReload 定期重新載入
+	if err := LoadLanguages(); err != nil {
+		log.Fatal("Failed to load languages: ", err)
+	}
 }
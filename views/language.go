@@ -0,0 +1,117 @@
+package views
+
+import (
+	"math"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/judgeservice"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/models"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/styleservice"
+	"github.com/gin-gonic/gin"
+)
+
+var languagesMu sync.RWMutex
+var languages = map[string]models.Language{}
+
+// LoadLanguages 從語言表載入啟用的語言，並更新 judge service 與 style service 支援的語言
+func LoadLanguages() (err error) {
+	var list []models.Language
+	var judgeLanguages, styleLanguages []string
+
+	if list, err = models.ListLanguages(); err != nil {
+		return
+	}
+
+	registry := make(map[string]models.Language, len(list))
+	for _, language := range list {
+		registry[language.Name] = language
+		judgeLanguages = append(judgeLanguages, language.Name)
+		if language.StyleCheck {
+			styleLanguages = append(styleLanguages, language.Name)
+		}
+	}
+
+	languagesMu.Lock()
+	languages = registry
+	languagesMu.Unlock()
+
+	judgeservice.SetLanguages(judgeLanguages)
+	styleservice.SetLanguages(styleLanguages)
+	return
+}
+
+// StartLanguageReload 每隔 interval 重新載入一次語言表，直到 stop 被關閉
+// 語言表的修改最晚在 interval 後生效，載入失敗時繼續使用原本的語言
+func StartLanguageReload(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := LoadLanguages(); err != nil {
+					log.Println("reload languages:", err)
+				}
+			}
+		}
+	}()
+}
+
+// languageExists 語言是否已啟用
+func languageExists(name string) bool {
+	languagesMu.RLock()
+	defer languagesMu.RUnlock()
+
+	_, ok := languages[name]
+	return ok
+}
+
+// languageLimits 依語言的倍率計算實際的時間與記憶體限制
+func languageLimits(name string, cpuTime, memoryLimit uint) (uint, uint) {
+	languagesMu.RLock()
+	language, ok := languages[name]
+	languagesMu.RUnlock()
+
+	if !ok {
+		return cpuTime, memoryLimit
+	}
+	return uint(math.Round(float64(cpuTime) * language.TimeMultiplier)),
+		uint(math.Round(float64(memoryLimit) * language.MemoryMultiplier))
+}
+
+// ListLanguages 列出所有可使用的語言
+func ListLanguages(c *gin.Context) {
+	var list []models.Language
+	var err error
+	var returnData = make([]gin.H, 0)
+
+	if list, err = models.ListLanguages(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	for _, language := range list {
+		returnData = append(returnData, gin.H{
+			"name":              language.Name,
+			"display_name":      language.DisplayName,
+			"version":           language.Version,
+			"compile_command":   language.CompileCommand,
+			"run_command":       language.RunCommand,
+			"time_multiplier":   language.TimeMultiplier,
+			"memory_multiplier": language.MemoryMultiplier,
+			"style_check":       language.StyleCheck,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"languages": returnData,
+	})
+}
@@ -0,0 +1,101 @@
+package views
+
+import (
+	"log"
+	"time"
+
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/models"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/queue"
+	"github.com/gin-gonic/gin"
+)
+
+// outboxPublisher 所有 task 都先寫入 outbox 再送出，送出失敗的 task 由 relay 重送
+type outboxPublisher struct {
+	queue queue.TaskQueue
+}
+
+// UseTaskQueue 設定 handler 送出 task 使用的 queue
+func UseTaskQueue(q queue.TaskQueue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("outbox", outboxPublisher{queue: q})
+		c.Next()
+	}
+}
+
+// getOutbox 讀取 router 設定的 outbox
+func getOutbox(c *gin.Context) outboxPublisher {
+	return c.MustGet("outbox").(outboxPublisher)
+}
+
+// Publish 寫入 outbox 後立即嘗試送出
+func (p outboxPublisher) Publish(name string, body []byte) (err error) {
+	w := models.NewOutboxWriter()
+
+	if err = w.Publish(name, body); err != nil {
+		return
+	}
+	p.deliver(w.Written)
+	return
+}
+
+// deliver 送出已寫入 outbox 的 task，失敗時留給 relay 重送
+func (p outboxPublisher) deliver(outboxes []models.Outbox) (sent int, err error) {
+	for _, o := range outboxes {
+		if err = p.queue.Publish(o.Queue, o.Payload); err != nil {
+			log.Println("publish outbox", o.ID, "failed:", err)
+			return
+		}
+		if err = models.MarkOutboxSent(o.ID); err != nil {
+			return
+		}
+		sent++
+	}
+	return
+}
+
+// RelayOutbox 送出建立超過 olderThan 且尚未送出的 task，回傳送出的數量
+func RelayOutbox(q queue.TaskQueue, olderThan time.Duration, limit int) (sent int, err error) {
+	var outboxes []models.Outbox
+
+	if outboxes, err = models.GetPendingOutbox(time.Now().Add(-olderThan), limit); err != nil {
+		return
+	}
+	return outboxPublisher{queue: q}.deliver(outboxes)
+}
+
+// PruneOutbox 刪除送出超過 retention 的 task，回傳刪除的數量
+func PruneOutbox(retention time.Duration) (int64, error) {
+	return models.DeleteSentOutbox(time.Now().Add(-retention))
+}
+
+// StartOutboxRelay 每隔 interval 送出 outbox 中尚未送出的 task，直到 stop 被關閉
+// 每小時刪除送出超過 retention 的 task
+func StartOutboxRelay(q queue.TaskQueue, interval, retention time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	pruneTicker := time.NewTicker(time.Hour)
+
+	go func() {
+		defer ticker.Stop()
+		defer pruneTicker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				sent, err := RelayOutbox(q, interval, 100)
+				if err != nil {
+					log.Println("relay outbox:", err)
+				} else if needLog || sent > 0 {
+					log.Printf("relay outbox: %d sent", sent)
+				}
+			case <-pruneTicker.C:
+				deleted, err := PruneOutbox(retention)
+				if err != nil {
+					log.Println("prune outbox:", err)
+				} else if needLog || deleted > 0 {
+					log.Printf("prune outbox: %d deleted", deleted)
+				}
+			}
+		}
+	}()
+}
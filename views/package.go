@@ -0,0 +1,601 @@
+package views
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/judgeservice"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/models"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// packageFormatVersion 目前的 problem package 格式版本
+const packageFormatVersion = 1
+
+// packageManifest problem package 中記錄題目資料的檔案
+const packageManifest = "problem.json"
+
+// packageTestCaseDir problem package 中 test case 所在的目錄，與 TESTCASEDIR 的結構相同
+const packageTestCaseDir = "testcase/"
+
+// packageAttachmentDir problem package 中附件所在的目錄，檔名即為附件名稱
+const packageAttachmentDir = "attachment/"
+
+// uploadSizeLimit 上傳的 problem package 與 test case 檔案的大小上限
+var uploadSizeLimit int64 = 256 << 20
+
+// zipSizeLimit 一個 zip 解壓縮後的總大小上限
+var zipSizeLimit uint64 = 1 << 30
+
+var errFileTooLarge = errors.New("file is too large")
+var errZipTooLarge = errors.New("zip content is too large")
+
+// problemPackageFields problem 本身的欄位，不含範例、tag 等其他資料表的內容
+func problemPackageFields(problem *models.Problem) (pkg problemPackage) {
+	pkg.FormatVersion = packageFormatVersion
+	pkg.ProblemName = problem.ProblemName
+	pkg.Description = problem.Description
+	pkg.InputDescription = problem.InputDescription
+	pkg.OutputDescription = problem.OutputDescription
+	pkg.ProgramName = problem.ProgramName
+	pkg.MemoryLimit = problem.MemoryLimit
+	pkg.CPUTime = problem.CPUTime
+	pkg.Layer = problem.Layer
+	pkg.Normalize = packageNormalize{
+		CRLF:               problem.NormalizeCRLF,
+		BOM:                problem.NormalizeBOM,
+		TrailingWhitespace: problem.TrimTrailingSpace,
+		FinalNewline:       problem.EnsureFinalNewline,
+	}
+	pkg.DefaultLocale = problem.StatementLocale()
+	return
+}
+
+// problemPackageData 讀取 problem 的題目資料，不含 test case
+func problemPackageData(problem *models.Problem) (pkg problemPackage, err error) {
+	var samples []models.SampleData
+	var languages []models.ProblemLanguage
+	var translations []models.ProblemTranslation
+
+	pkg = problemPackageFields(problem)
+	if pkg.Tags, err = models.GetProblemAllTags(problem.ID); err != nil {
+		return
+	}
+	if samples, err = models.GetProblemSortedSamples(problem.ID); err != nil {
+		return
+	}
+	for _, sample := range samples {
+		pkg.Samples = append(pkg.Samples, packageSample{Input: sample.Input, Output: sample.Output})
+	}
+	if languages, err = models.GetProblemLanguages(problem.ID); err != nil {
+		return
+	}
+	for _, language := range languages {
+		pkg.Languages = append(pkg.Languages, problemLanguageTemplate{
+			Language:    language.Language,
+			CPUTime:     language.CPUTime,
+			MemoryLimit: language.MemoryLimit,
+		})
+	}
+	if translations, err = models.GetProblemTranslations(problem.ID); err != nil {
+		return
+	}
+	for _, t := range translations {
+		pkg.Translations = append(pkg.Translations, packageTranslation{
+			Locale:            t.Locale,
+			ProblemName:       t.ProblemName,
+			Description:       t.Description,
+			InputDescription:  t.InputDescription,
+			OutputDescription: t.OutputDescription,
+		})
+	}
+	if validator, err := models.GetValidatorByProblemID(problem.ID); err == nil {
+		pkg.Validator = &packageValidator{Language: validator.Language, SourceCode: validator.SourceCode}
+	}
+	return
+}
+
+// buildProblemPackage 匯出 problem 的題目資料、test case 與附件檔案
+func buildProblemPackage(problem *models.Problem) (pkg problemPackage, files map[string][]byte, err error) {
+	var cases []testCase
+	var attachments []packageAttachment
+	var info, manifest []byte
+
+	if pkg, err = problemPackageData(problem); err != nil {
+		return
+	}
+	if manifest, err = json.MarshalIndent(pkg, "", " "); err != nil {
+		return
+	}
+	files = map[string][]byte{packageManifest: manifest}
+
+	if cases, err = loadTestCases(problem.ID); err != nil {
+		return
+	}
+	for i, tc := range cases {
+		name := strconv.Itoa(i + 1)
+		files[packageTestCaseDir+name+".in"] = tc.Input
+		files[packageTestCaseDir+name+".out"] = tc.Output
+	}
+	if info, err = storage.Store.Get(testCasePrefix(problem.ID) + "/info"); err == nil {
+		files[packageTestCaseDir+"info"] = info
+	} else if err != storage.ErrNotExist {
+		return
+	}
+	if attachments, err = loadAttachments(problem.ID); err != nil {
+		return
+	}
+	for _, attachment := range attachments {
+		files[packageAttachmentDir+attachment.name] = attachment.body
+	}
+	return
+}
+
+// writeProblemPackage 將 problem package 寫入 zip 的 dir 目錄下
+func writeProblemPackage(zw *zip.Writer, dir string, problem *models.Problem) (err error) {
+	var files map[string][]byte
+
+	if _, files, err = buildProblemPackage(problem); err != nil {
+		return
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		w, err := zw.Create(dir + name)
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(files[name]); err != nil {
+			return err
+		}
+	}
+	return
+}
+
+// zipBudget 同一個 zip 還可以解壓縮的大小
+type zipBudget uint64
+
+// newZipBudget 建立 zipSizeLimit 大小的 budget
+func newZipBudget() *zipBudget {
+	budget := zipBudget(zipSizeLimit)
+	return &budget
+}
+
+// readZipFile 讀取 zip 中的檔案，解壓縮的大小超過剩餘的 budget 時回傳 errZipTooLarge
+func readZipFile(file *zip.File, budget *zipBudget) ([]byte, error) {
+	if file.UncompressedSize64 > uint64(*budget) {
+		return nil, errZipTooLarge
+	}
+	r, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	// 不相信 header 記錄的大小
+	body, err := ioutil.ReadAll(io.LimitReader(r, int64(*budget)+1))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(body)) > uint64(*budget) {
+		return nil, errZipTooLarge
+	}
+	*budget -= zipBudget(len(body))
+	return body, nil
+}
+
+// readProblemPackages 讀取 zip 中所有的 problem package，
+// problem.json 位於根目錄為單一題目，位於第一層目錄為多個題目
+func readProblemPackages(body []byte) (problems []importedProblem, err error) {
+	var dirs []string
+
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, errNotZip
+	}
+
+	budget := newZipBudget()
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, file := range zr.File {
+		files[file.Name] = file
+
+		if !strings.HasSuffix(file.Name, packageManifest) {
+			continue
+		}
+		dir := strings.TrimSuffix(file.Name, packageManifest)
+		if dir == "" || (strings.HasSuffix(dir, "/") && strings.Count(dir, "/") == 1) {
+			dirs = append(dirs, dir)
+		}
+	}
+	if len(dirs) == 0 {
+		return nil, errors.New("problem.json not found")
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		var pkg problemPackage
+		var tcs []testCase
+		var body []byte
+
+		if body, err = readZipFile(files[dir+packageManifest], budget); err != nil {
+			return
+		}
+		if err = json.Unmarshal(body, &pkg); err != nil {
+			return nil, fmt.Errorf("%s%s: %v", dir, packageManifest, err)
+		}
+
+		for i := 1; ; i++ {
+			var tc testCase
+			name := dir + packageTestCaseDir + strconv.Itoa(i)
+
+			in, inOK := files[name+".in"]
+			out, outOK := files[name+".out"]
+			if !inOK || !outOK {
+				break
+			}
+			if tc.Input, err = readZipFile(in, budget); err != nil {
+				return
+			}
+			if tc.Output, err = readZipFile(out, budget); err != nil {
+				return
+			}
+			tcs = append(tcs, tc)
+		}
+
+		var attachments []packageAttachment
+		for _, file := range zr.File {
+			name := strings.TrimPrefix(file.Name, dir+packageAttachmentDir)
+			if name == file.Name || name == "" || strings.Contains(name, "/") {
+				continue
+			}
+			var attachment = packageAttachment{name: name}
+			if attachment.body, err = readZipFile(file, budget); err != nil {
+				return
+			}
+			attachments = append(attachments, attachment)
+		}
+
+		problems = append(problems, importedProblem{pkg: pkg, cases: tcs, attachments: attachments})
+	}
+	return
+}
+
+// checkProblemPackage 檢查 problem package 的題目資料
+func checkProblemPackage(pkg *problemPackage) error {
+	if pkg.FormatVersion < 1 || pkg.FormatVersion > packageFormatVersion {
+		return fmt.Errorf("unsupported format version %d", pkg.FormatVersion)
+	}
+	if pkg.ProblemName == "" {
+		return errors.New("problem_name is required")
+	}
+	if !regexp.MustCompile(`^[a-zA-Z0-9]+$`).MatchString(pkg.ProgramName) {
+		return errors.New("ProgramName can only contain letters and numbers")
+	}
+	if pkg.MemoryLimit > 512*1024*1024 {
+		return errors.New("Out of Max memorylimit")
+	}
+	if err := checkProblemLanguages(&problemOptionAPIRequest{Languages: &pkg.Languages}); err != nil {
+		return err
+	}
+	if pkg.Validator != nil {
+		validateTask := judgeservice.ValidateTask{Language: pkg.Validator.Language}
+		if err := validateTask.Validate(); err != nil {
+			return fmt.Errorf("validator: %v", err)
+		}
+	}
+	if err := checkPackageTranslations(pkg); err != nil {
+		return err
+	}
+	return nil
+}
+
+// setProblemFromPackage 以 problem package 的題目資料設定 problem
+func setProblemFromPackage(problem *models.Problem, pkg *problemPackage) {
+	problem.ProblemName = pkg.ProblemName
+	problem.Description = pkg.Description
+	problem.InputDescription = pkg.InputDescription
+	problem.OutputDescription = pkg.OutputDescription
+	problem.ProgramName = pkg.ProgramName
+	problem.MemoryLimit = pkg.MemoryLimit
+	problem.CPUTime = pkg.CPUTime
+	problem.Layer = pkg.Layer
+	problem.NormalizeCRLF = pkg.Normalize.CRLF
+	problem.NormalizeBOM = pkg.Normalize.BOM
+	problem.TrimTrailingSpace = pkg.Normalize.TrailingWhitespace
+	problem.EnsureFinalNewline = pkg.Normalize.FinalNewline
+	if pkg.DefaultLocale != "" {
+		problem.DefaultLocale = pkg.DefaultLocale
+	}
+}
+
+// discardProblem 永久刪除匯入失敗的題目與 test case
+func discardProblem(problemID uint) (err error) {
+	if _, err = models.PurgeProblem(problemID, true, false, nil); err != nil {
+		return
+	}
+	if err = storage.Store.Delete(testCasePrefix(problemID)); err != nil {
+		return
+	}
+	return storage.Store.Delete(attachmentPrefix(problemID))
+}
+
+// discardProblems 永久刪除匯入失敗時已建立的題目，回傳無法刪除的題目
+func discardProblems(problemIDs []uint) (remaining []uint) {
+	remaining = make([]uint, 0)
+	for _, id := range problemIDs {
+		if err := discardProblem(id); err != nil {
+			log.Printf("discard problem %d: %v", id, err)
+			remaining = append(remaining, id)
+		}
+	}
+	return
+}
+
+// importProblemPackage 以 problem package 建立題目，作者為 userID
+// 建立失敗時刪除已建立的部分，無法刪除時回傳的 problem 仍保留 id
+func importProblemPackage(outbox outboxPublisher, pkg *problemPackage, cases []testCase, attachments []packageAttachment, userID uint) (problem models.Problem, validating bool, err error) {
+	setProblemFromPackage(&problem, pkg)
+	problem.Author = userID
+	problem.Visibility = models.VisibilityDraft
+
+	if err = models.AddProblem(&problem); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil && len(discardProblems([]uint{problem.ID})) == 0 {
+			problem = models.Problem{}
+		}
+	}()
+
+	for _, tag := range pkg.Tags {
+		if err = models.AddTag2Problem(problem.ID, tag); err != nil {
+			return
+		}
+	}
+	for i, s := range pkg.Samples {
+		sample := models.Sample{Input: s.Input, Output: s.Output, Sort: uint(i + 1), ProblemID: problem.ID}
+		if err = models.AddSample(&sample); err != nil {
+			return
+		}
+	}
+	if len(pkg.Languages) > 0 {
+		if err = saveProblemLanguages(problem.ID, &problemOptionAPIRequest{Languages: &pkg.Languages}); err != nil {
+			return
+		}
+	}
+	if pkg.Validator != nil {
+		validator := models.Validator{
+			ProblemID:  problem.ID,
+			Language:   pkg.Validator.Language,
+			SourceCode: pkg.Validator.SourceCode,
+		}
+		if err = models.SetValidator(&validator); err != nil {
+			return
+		}
+	}
+	if err = saveProblemTranslations(problem.ID, pkg.Translations); err != nil {
+		return
+	}
+	if err = saveAttachments(problem.ID, attachments, userID); err != nil {
+		return
+	}
+
+	if len(cases) > 0 {
+		if _, _, err = saveTestCases(&problem, cases); err != nil {
+			return
+		}
+	}
+	if validating, err = updateTestCaseStatus(outbox, &problem, len(cases)); err != nil {
+		return
+	}
+	err = recordProblemRevision(&problem, userID, 0)
+	return
+}
+
+// sendProblemPackages 以 zip 回傳 problems 的 problem package，多個題目時各自放在以 problem id 命名的目錄
+func sendProblemPackages(c *gin.Context, filename string, problems []models.Problem, single bool) {
+	var buf bytes.Buffer
+
+	zw := zip.NewWriter(&buf)
+	for i := range problems {
+		dir := ""
+		if !single {
+			dir = strconv.Itoa(int(problems[i].ID)) + "/"
+		}
+		if err := writeProblemPackage(zw, dir, &problems[i]); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"message": "系統錯誤",
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Data(http.StatusOK, "application/zip", buf.Bytes())
+}
+
+// ExportProblem 匯出題目為 problem package
+func ExportProblem(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "problem id is invalid",
+		})
+		return
+	}
+
+	problem, err := models.GetProblemByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "無此題目",
+		})
+		return
+	}
+
+	sendProblemPackages(c, "problem-"+strconv.Itoa(id)+".zip", []models.Problem{problem}, true)
+}
+
+// ExportProblemSet 匯出 tag 或 author 的所有題目
+func ExportProblemSet(c *gin.Context) {
+	var problems []models.Problem
+	var err error
+
+	tag, author := c.Query("tag"), c.Query("author")
+	switch {
+	case tag != "":
+		problems, err = models.GetProblemsByTag(tag)
+	case author != "":
+		var id int
+		if id, err = strconv.Atoi(author); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "author is invalid",
+			})
+			return
+		}
+		problems, err = models.GetProblemsByAuthor(uint(id))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "tag or author is required",
+		})
+		return
+	}
+	if err == nil {
+		v := currentViewer(c)
+		problems, err = filterProblemsByRole(problems, &v, models.RoleViewer)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+	if len(problems) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "無此題目",
+		})
+		return
+	}
+
+	sendProblemPackages(c, "problemset.zip", problems, false)
+}
+
+// ImportProblemSet 匯入 problem package 或 format 指定的其他系統格式，可包含一個或多個題目
+func ImportProblemSet(c *gin.Context) {
+	var problems []importedProblem
+	var results = make([]gin.H, 0)
+	userID := c.MustGet("userID").(uint)
+
+	importer, ok := importers[c.Params.ByName("format")]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "unsupported format",
+		})
+		return
+	}
+
+	file, err := c.FormFile("package")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "package is required",
+		})
+		return
+	}
+	body, err := readFormFile(file, uploadSizeLimit)
+	if err != nil {
+		if errors.Is(err, errFileTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	if problems, err = importer(body); err != nil {
+		if errors.Is(err, errZipTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+	// 全部檢查通過才開始建立題目
+	for i := range problems {
+		if err = checkProblemPackage(&problems[i].pkg); err == nil {
+			err = checkAttachments(problems[i].attachments)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": err.Error(),
+				"index":   i,
+			})
+			return
+		}
+	}
+
+	var imported []uint
+	for i := range problems {
+		problem, validating, err := importProblemPackage(getOutbox(c), &problems[i].pkg, problems[i].cases, problems[i].attachments, userID)
+		if err != nil {
+			// 刪除這次已匯入的題目，回傳無法刪除而留下的題目
+			if problem.ID != 0 {
+				imported = append(imported, problem.ID)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"message":   "題目匯入失敗",
+				"error":     err.Error(),
+				"index":     i,
+				"remaining": discardProblems(imported),
+			})
+			return
+		}
+		imported = append(imported, problem.ID)
+		unsupported := problems[i].unsupported
+		if unsupported == nil {
+			unsupported = make([]string, 0)
+		}
+		results = append(results, gin.H{
+			"problem_id":   problem.ID,
+			"problem_name": problem.ProblemName,
+			"test_cases":   len(problems[i].cases),
+			"validating":   validating,
+			"unsupported":  unsupported,
+		})
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "匯入成功",
+		"problems": results,
+	})
+}
@@ -0,0 +1,259 @@
+package views
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/models"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+)
+
+// roleLevel 權限的高低，沒有權限為 0
+var roleLevel = map[string]int{
+	models.RoleViewer: 1,
+	models.RoleEditor: 2,
+	models.RoleOwner:  3,
+}
+
+// problemRole 使用者在題目的權限，管理員與作者為 owner，沒有權限時為空字串
+func problemRole(problem *models.Problem, v *viewer) (string, error) {
+	if v.admin || problem.Author == v.userID {
+		return models.RoleOwner, nil
+	}
+	permission, err := models.GetProblemPermission(problem.ID, v.userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	return permission.Role, err
+}
+
+// hasProblemRole 使用者在題目的權限是否至少為 role
+func hasProblemRole(problem *models.Problem, v *viewer, role string) (bool, error) {
+	current, err := problemRole(problem, v)
+	if err != nil {
+		return false, err
+	}
+	return roleLevel[current] >= roleLevel[role], nil
+}
+
+// filterProblemsByRole 只保留使用者至少有 role 權限的題目
+func filterProblemsByRole(problems []models.Problem, v *viewer, role string) (kept []models.Problem, err error) {
+	for i := range problems {
+		var ok bool
+
+		if ok, err = hasProblemRole(&problems[i], v, role); err != nil {
+			return nil, err
+		}
+		if ok {
+			kept = append(kept, problems[i])
+		}
+	}
+	return
+}
+
+// RequireProblemRole 檢查使用者在 url 中的題目至少有 role 權限
+func RequireProblemRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Params.ByName("id"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"message": "problem id is invalid",
+			})
+			return
+		}
+		problem, err := models.GetProblemByID(uint(id))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+				"message": "無此題目",
+			})
+			return
+		}
+
+		v := currentViewer(c)
+		ok, err := hasProblemRole(&problem, &v, role)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"message": "系統錯誤",
+			})
+			return
+		}
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"message": "權限不足",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// ListProblemPermissions 列出題目的作者與被授權的使用者
+func ListProblemPermissions(c *gin.Context) {
+	var permissions []models.ProblemPermission
+	var returnData = make([]gin.H, 0)
+
+	id, _ := strconv.Atoi(c.Params.ByName("id"))
+	problem, err := models.GetProblemByID(uint(id))
+	if err == nil {
+		permissions, err = models.GetProblemPermissions(problem.ID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	returnData = append(returnData, gin.H{
+		"user_id": problem.Author,
+		"role":    models.RoleOwner,
+	})
+	for _, permission := range permissions {
+		returnData = append(returnData, gin.H{
+			"user_id": permission.UserID,
+			"role":    permission.Role,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"problem_id":  problem.ID,
+		"permissions": returnData,
+	})
+}
+
+// permissionTarget 讀取 url 中的題目與被授權的使用者
+func permissionTarget(c *gin.Context) (problem models.Problem, userID uint, ok bool) {
+	id, _ := strconv.Atoi(c.Params.ByName("id"))
+	user, err := strconv.Atoi(c.Params.ByName("userID"))
+	if err != nil || user <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "user id is invalid",
+		})
+		return
+	}
+	if problem, err = models.GetProblemByID(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "無此題目",
+		})
+		return
+	}
+	if problem.Author == uint(user) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "author is always the owner",
+		})
+		return
+	}
+	return problem, uint(user), true
+}
+
+// GrantProblemPermission 授予使用者題目的權限，已有權限時取代
+func GrantProblemPermission(c *gin.Context) {
+	var data struct {
+		Role string `json:"role"`
+	}
+
+	problem, userID, ok := permissionTarget(c)
+	if !ok {
+		return
+	}
+	if err := c.ShouldBindBodyWith(&data, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "未按照格式填寫或未使用json",
+		})
+		return
+	}
+	if data.Role != models.RoleEditor && data.Role != models.RoleViewer {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "role must be editor or viewer",
+		})
+		return
+	}
+
+	if err := models.SetProblemPermission(problem.ID, userID, data.Role); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "權限設定成功",
+		"problem_id": problem.ID,
+		"user_id":    userID,
+		"role":       data.Role,
+	})
+}
+
+// RevokeProblemPermission 移除使用者題目的權限
+func RevokeProblemPermission(c *gin.Context) {
+	problem, userID, ok := permissionTarget(c)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteProblemPermission(problem.ID, userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": "該使用者沒有權限",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "權限移除成功",
+		"problem_id": problem.ID,
+		"user_id":    userID,
+	})
+}
+
+// GetSubmissionDetail 讀取提交的程式碼與各 test case 結果，只有提交者與有題目權限的使用者可以讀取
+func GetSubmissionDetail(c *gin.Context) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "submission id is invalid",
+		})
+		return
+	}
+	submission, err := models.GetSubmissionByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "無此提交",
+		})
+		return
+	}
+
+	v := currentViewer(c)
+	if submission.Author != v.userID {
+		problem, err := models.GetProblemByID(submission.ProblemID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": "無此題目",
+			})
+			return
+		}
+		ok, err := hasProblemRole(&problem, &v, models.RoleViewer)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"message": "系統錯誤",
+			})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusForbidden, gin.H{
+				"message": "權限不足",
+			})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, submissionDetail(&submission))
+}
@@ -15,7 +15,14 @@ func Pong(c *gin.Context) {
 		})
 		return
 	}
+
+	// 只回報連線狀態，queue 深度等資訊由 admin 的 queue 狀態查詢
+	connected := getOutbox(c).queue.Connected()
 	c.JSON(http.StatusOK, gin.H{
 		"message": "pong",
+		"queue": gin.H{
+			"judgeservice": connected,
+			"styleservice": connected,
+		},
 	})
 }
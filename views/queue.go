@@ -0,0 +1,117 @@
+package views
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/judgeservice"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/models"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/queue"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/styleservice"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// throughputMinutes 預設計算最近幾分鐘的評測量
+const throughputMinutes = 10
+
+// errQueueUnavailable 無法查詢 queue 的狀態
+var errQueueUnavailable = errors.New("queue unavailable")
+
+// inspectQueues 查詢各 queue 的待處理數量與 consumer 數量
+func inspectQueues(q queue.TaskQueue, names []string) (queues []gin.H, messages, consumers int, err error) {
+	queues = make([]gin.H, 0)
+	for _, name := range names {
+		var info queue.QueueInfo
+
+		if info, err = q.Inspect(name); err != nil {
+			return
+		}
+		messages += info.Messages
+		consumers += info.Consumers
+		queues = append(queues, gin.H{
+			"queue":     name,
+			"messages":  info.Messages,
+			"consumers": info.Consumers,
+		})
+	}
+	return
+}
+
+// queueStatus judge service 與 style service 的 queue 狀態、最久的待評測提交與最近 minutes 分鐘的評測量
+func queueStatus(q queue.TaskQueue, minutes int) (status gin.H, err error) {
+	var lanes, style = make([]gin.H, 0), make([]gin.H, 0)
+	var judgeMessages, judgeConsumers, styleMessages, styleConsumers int
+	var judged int64
+	var oldest float64
+
+	connected := q.Connected()
+	if connected {
+		if lanes, judgeMessages, judgeConsumers, err = inspectQueues(q, judgeservice.Lanes); err != nil {
+			return nil, fmt.Errorf("%w: %v", errQueueUnavailable, err)
+		}
+		if style, styleMessages, styleConsumers, err = inspectQueues(q, []string{styleservice.QueueName}); err != nil {
+			return nil, fmt.Errorf("%w: %v", errQueueUnavailable, err)
+		}
+	}
+
+	// 沒有待評測的提交時 oldest 為 0
+	submission, err := models.GetOldestPendingSubmission()
+	if err == nil {
+		oldest = time.Since(submission.CreatedAt).Seconds()
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return
+	}
+	if judged, err = models.CountJudgedSubmissions(time.Now().Add(-time.Duration(minutes) * time.Minute)); err != nil {
+		return
+	}
+
+	status = gin.H{
+		"connected": connected,
+		"judge": gin.H{
+			"messages":  judgeMessages,
+			"consumers": judgeConsumers,
+		},
+		"style": gin.H{
+			"messages":  styleMessages,
+			"consumers": styleConsumers,
+		},
+		"lanes":              lanes,
+		"style_queues":       style,
+		"oldest_pending_age": oldest,
+		"throughput": gin.H{
+			"minutes":    minutes,
+			"judged":     judged,
+			"per_minute": float64(judged) / float64(minutes),
+		},
+	}
+	return
+}
+
+// GetQueueStatus 評測 queue 狀態，minutes 指定計算評測量的分鐘數
+func GetQueueStatus(c *gin.Context) {
+	minutes := throughputMinutes
+	if m, err := strconv.Atoi(c.Query("minutes")); err == nil && m > 0 {
+		minutes = m
+	}
+
+	status, err := queueStatus(getOutbox(c).queue, minutes)
+	if errors.Is(err, errQueueUnavailable) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"message": "queue unavailable",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,284 @@
+package views
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/models"
+	"github.com/gin-gonic/gin"
+)
+
+var referenceExpected = []string{"AC", "WA", "TLE"}
+
+// verdictOf 將 judge 結果轉為 AC / WA / TLE 等簡稱
+func verdictOf(status int) string {
+	switch status {
+	case 0:
+		return "AC"
+	case -1:
+		return "WA"
+	case -2:
+		return "CE"
+	case 1, 2:
+		return "TLE"
+	case 3:
+		return "MLE"
+	case 4:
+		return "RE"
+	default:
+		return "SE"
+	}
+}
+
+// CreateReferenceSolution 新增參考解答
+func CreateReferenceSolution(c *gin.Context) {
+	var data referenceAPIRequest
+	var solution models.ReferenceSolution
+	userID := c.MustGet("userID").(uint)
+
+	problem, _, ok := getTestCaseProblem(c)
+	if !ok {
+		return
+	}
+
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "未按照格式填寫或未使用json",
+		})
+		return
+	}
+	if data.SourceCode == nil || data.Language == nil || data.Expected == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "未填寫完成",
+		})
+		return
+	}
+	if !contains(referenceExpected, *data.Expected) || (data.IsMain && *data.Expected != "AC") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "expected must be AC, WA or TLE, and main solution must be AC",
+		})
+		return
+	}
+
+	solution.ProblemID = problem.ID
+	solution.Author = userID
+	solution.Language = *data.Language
+	solution.SourceCode = *data.SourceCode
+	solution.Expected = *data.Expected
+	solution.IsMain = data.IsMain
+
+	judgeTask, err := newJudgeTask(&problem, &models.Submission{Language: solution.Language})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+	if err := judgeTask.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := models.AddReferenceSolution(&solution); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":     "新增成功",
+		"problem_id":  problem.ID,
+		"solution_id": solution.ID,
+	})
+}
+
+// ListReferenceSolutions 列出題目所有參考解答
+func ListReferenceSolutions(c *gin.Context) {
+	var solutions []models.ReferenceSolution
+	var err error
+	var returnData = make([]gin.H, 0)
+
+	problem, _, ok := getTestCaseProblem(c)
+	if !ok {
+		return
+	}
+
+	if solutions, err = models.GetProblemReferenceSolutions(problem.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	for _, solution := range solutions {
+		returnData = append(returnData, gin.H{
+			"solution_id":   solution.ID,
+			"author":        solution.Author,
+			"language":      solution.Language,
+			"source_code":   solution.SourceCode,
+			"expected":      solution.Expected,
+			"is_main":       solution.IsMain,
+			"submission_id": solution.SubmissionID,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"solutions": returnData,
+	})
+}
+
+// DeleteReferenceSolution 刪除參考解答
+func DeleteReferenceSolution(c *gin.Context) {
+	problem, _, ok := getTestCaseProblem(c)
+	if !ok {
+		return
+	}
+
+	solutionID, err := strconv.Atoi(c.Params.ByName("solutionID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "solution id is invalid",
+		})
+		return
+	}
+
+	if err = models.DeleteReferenceSolution(problem.ID, uint(solutionID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "無此參考解答",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "刪除成功",
+	})
+}
+
+// RunReferenceSolutions 手動以目前 test case 重新執行所有參考解答
+func RunReferenceSolutions(c *gin.Context) {
+	problem, cases, ok := getTestCaseProblem(c)
+	if !ok {
+		return
+	}
+
+	if len(cases) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "problem has no test case",
+		})
+		return
+	}
+
+	count, err := runReferenceSolutions(getOutbox(c), &problem)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "執行成功",
+		"reference_runs": count,
+	})
+}
+
+// GetReferenceReport 參考解答驗證報告，標記主要解答未 AC 的 test case 與結果不符預期的解答
+func GetReferenceReport(c *gin.Context) {
+	var solutions []models.ReferenceSolution
+	var err error
+	var results = make([]gin.H, 0)
+	var flags = make([]gin.H, 0)
+	pending := false
+
+	problem, _, ok := getTestCaseProblem(c)
+	if !ok {
+		return
+	}
+
+	if solutions, err = models.GetProblemReferenceSolutions(problem.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	for _, solution := range solutions {
+		var submission models.SubmissionStatus
+		var testcase = make([]gin.H, 0)
+
+		if solution.SubmissionID == 0 {
+			pending = true
+			results = append(results, gin.H{
+				"solution_id": solution.ID,
+				"expected":    solution.Expected,
+				"is_main":     solution.IsMain,
+				"verdict":     "pending",
+				"testcase":    testcase,
+			})
+			continue
+		}
+
+		if submission, err = models.GetSubmissionByID(solution.SubmissionID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"message": "系統錯誤",
+			})
+			return
+		}
+
+		verdict := verdictOf(submission.Status)
+		if !submission.IsRating {
+			pending = true
+			verdict = "pending"
+		}
+
+		for _, t := range submission.TestCase {
+			testcase = append(testcase, gin.H{
+				"test_case": t.TestCase,
+				"verdict":   verdictOf(t.Status),
+				"cpu_time":  t.CPUTime,
+				"memory":    t.Memory,
+			})
+			if solution.IsMain && t.Status != 0 {
+				flags = append(flags, gin.H{
+					"solution_id": solution.ID,
+					"test_case":   t.TestCase,
+					"reason":      fmt.Sprintf("main solution got %s", verdictOf(t.Status)),
+				})
+			}
+		}
+
+		if submission.IsRating && verdict != solution.Expected {
+			reason := fmt.Sprintf("expected %s but got %s", solution.Expected, verdict)
+			if verdict == "AC" {
+				reason = fmt.Sprintf("expected %s but unexpectedly passed", solution.Expected)
+			}
+			flags = append(flags, gin.H{
+				"solution_id": solution.ID,
+				"test_case":   "",
+				"reason":      reason,
+			})
+		}
+
+		results = append(results, gin.H{
+			"solution_id":   solution.ID,
+			"submission_id": solution.SubmissionID,
+			"expected":      solution.Expected,
+			"is_main":       solution.IsMain,
+			"verdict":       verdict,
+			"testcase":      testcase,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"problem_id": problem.ID,
+		"pending":    pending,
+		"passed":     !pending && len(flags) == 0,
+		"solutions":  results,
+		"flags":      flags,
+	})
+}
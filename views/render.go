@@ -0,0 +1,266 @@
+package views
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/models"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// renderCacheSize 快取的題目數上限，超過時清空快取
+const renderCacheSize = 1024
+
+// mathPlaceholder 渲染 Markdown 前取代數學式的文字，只包含英數字以免被 Markdown 改變
+const mathPlaceholder = "NCNUOJMATHPLACEHOLDER"
+
+// attachmentScheme 敘述中以 attachment:檔名 引用題目的附件
+const attachmentScheme = "attachment:"
+
+// renderedStatement 渲染並過濾後的題目敘述 html
+type renderedStatement struct {
+	Description       string `json:"description"`
+	InputDescription  string `json:"input_description"`
+	OutputDescription string `json:"output_description"`
+}
+
+type renderEntry struct {
+	hash      [sha256.Size]byte
+	statement renderedStatement
+}
+
+var renderCacheMu sync.Mutex
+
+// renderCache 依題目與語言快取渲染結果，題目敘述改變時清除
+var renderCache = map[uint]map[string]renderEntry{}
+
+var problemIDKey = parser.NewContextKey()
+
+// attachmentLinks 將 attachment:檔名 的連結與圖片改為題目附件的網址
+type attachmentLinks struct{}
+
+func (attachmentLinks) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	problemID, ok := pc.Get(problemIDKey).(uint)
+	if !ok {
+		return
+	}
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		var destination *[]byte
+		switch node := n.(type) {
+		case *ast.Link:
+			destination = &node.Destination
+		case *ast.Image:
+			destination = &node.Destination
+		default:
+			return ast.WalkContinue, nil
+		}
+		if bytes.HasPrefix(*destination, []byte(attachmentScheme)) {
+			name := string((*destination)[len(attachmentScheme):])
+			*destination = []byte(attachmentURL(problemID, name))
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// markdown 敘述使用 GitHub Flavored Markdown，html 由 statementPolicy 過濾
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithParserOptions(
+		parser.WithASTTransformers(util.Prioritized(attachmentLinks{}, 100)),
+	),
+	goldmark.WithRendererOptions(goldmarkhtml.WithUnsafe()),
+)
+
+// statementPolicy 只保留一般使用者內容可用的 html，另外保留程式碼語言與數學式的 class 給前端使用
+var statementPolicy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[a-zA-Z0-9+#_-]+$`)).OnElements("code")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^math math-(inline|display)$`)).OnElements("span")
+	return p
+}()
+
+// mathDelimiters 數學式的分隔符號，$$ 需在 $ 之前比對
+var mathDelimiters = []struct {
+	open, close string
+	display     bool
+}{
+	{"$$", "$$", true},
+	{`\[`, `\]`, true},
+	{`\(`, `\)`, false},
+	{"$", "$", false},
+}
+
+// fencedCode 找出 fenced code block 的範圍，範圍內的文字不視為數學式
+func fencedCode(src string) (ranges [][2]int) {
+	var fence string
+	var start int
+
+	offset := 0
+	for _, line := range strings.SplitAfter(src, "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if fence == "" {
+			if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+				fence = trimmed[:3]
+				start = offset
+			}
+		} else if strings.HasPrefix(strings.TrimSpace(trimmed), fence) {
+			ranges = append(ranges, [2]int{start, offset + len(line)})
+			fence = ""
+		}
+		offset += len(line)
+	}
+	if fence != "" {
+		ranges = append(ranges, [2]int{start, len(src)})
+	}
+	return
+}
+
+// matchMath 比對 src[i:] 開頭的數學式，回傳數學式的結尾位置
+func matchMath(src string, i int) (end int, display bool, ok bool) {
+	for _, d := range mathDelimiters {
+		if !strings.HasPrefix(src[i:], d.open) {
+			continue
+		}
+		from := i + len(d.open)
+		n := strings.Index(src[from:], d.close)
+		if n <= 0 {
+			return 0, false, false
+		}
+		content := src[from : from+n]
+		end = from + n + len(d.close)
+		if d.open == "$" {
+			// 與 pandoc 相同，避免將金額視為數學式
+			if strings.Contains(content, "\n\n") || strings.TrimSpace(content) != content ||
+				(end < len(src) && src[end] >= '0' && src[end] <= '9') {
+				return 0, false, false
+			}
+		}
+		return end, d.display, true
+	}
+	return 0, false, false
+}
+
+// protectMath 將程式碼以外的數學式換成 placeholder，回傳取代後的文字與數學式的 html
+func protectMath(src string) (string, []string) {
+	var out strings.Builder
+	var math []string
+
+	code := fencedCode(src)
+	for i := 0; i < len(src); {
+		if len(code) > 0 && i >= code[0][0] {
+			out.WriteString(src[i:code[0][1]])
+			i = code[0][1]
+			code = code[1:]
+			continue
+		}
+		switch {
+		case src[i] == '`':
+			n := i
+			for n < len(src) && src[n] == '`' {
+				n++
+			}
+			run := src[i:n]
+			if m := strings.Index(src[n:], run); m >= 0 {
+				n += m + len(run)
+			}
+			out.WriteString(src[i:n])
+			i = n
+			continue
+		case strings.HasPrefix(src[i:], `\$`):
+			out.WriteString(`\$`)
+			i += 2
+			continue
+		}
+		if end, display, ok := matchMath(src, i); ok {
+			class := "math math-inline"
+			if display {
+				class = "math math-display"
+			}
+			fmt.Fprintf(&out, "%s%dX", mathPlaceholder, len(math))
+			math = append(math, `<span class="`+class+`">`+html.EscapeString(src[i:end])+`</span>`)
+			i = end
+			continue
+		}
+		out.WriteByte(src[i])
+		i++
+	}
+	return out.String(), math
+}
+
+// renderMarkdown 將 Markdown 渲染為過濾後的 html，數學式保留原本的分隔符號給 KaTeX 使用
+func renderMarkdown(problemID uint, src string) (string, error) {
+	var buf bytes.Buffer
+
+	protected, math := protectMath(src)
+	ctx := parser.NewContext()
+	ctx.Set(problemIDKey, problemID)
+	if err := markdown.Convert([]byte(protected), &buf, parser.WithContext(ctx)); err != nil {
+		return "", err
+	}
+
+	rendered := buf.String()
+	for i, m := range math {
+		rendered = strings.Replace(rendered, fmt.Sprintf("%s%dX", mathPlaceholder, i), m, -1)
+	}
+	return statementPolicy.Sanitize(rendered), nil
+}
+
+// renderStatement 渲染題目 locale 語言的敘述，敘述未改變時使用快取
+func renderStatement(problem *models.Problem, locale string) (statement renderedStatement, err error) {
+	hash := sha256.Sum256([]byte(strings.Join([]string{
+		problem.Description, problem.InputDescription, problem.OutputDescription,
+	}, "\x00")))
+
+	renderCacheMu.Lock()
+	entry, ok := renderCache[problem.ID][locale]
+	renderCacheMu.Unlock()
+	if ok && entry.hash == hash {
+		return entry.statement, nil
+	}
+
+	for _, field := range []struct {
+		dst *string
+		src string
+	}{
+		{&statement.Description, problem.Description},
+		{&statement.InputDescription, problem.InputDescription},
+		{&statement.OutputDescription, problem.OutputDescription},
+	} {
+		if *field.dst, err = renderMarkdown(problem.ID, field.src); err != nil {
+			return
+		}
+	}
+
+	renderCacheMu.Lock()
+	if len(renderCache) >= renderCacheSize {
+		renderCache = map[uint]map[string]renderEntry{}
+	}
+	if renderCache[problem.ID] == nil {
+		renderCache[problem.ID] = map[string]renderEntry{}
+	}
+	renderCache[problem.ID][locale] = renderEntry{hash: hash, statement: statement}
+	renderCacheMu.Unlock()
+	return
+}
+
+// invalidateRenderCache 題目敘述改變時清除題目所有語言的渲染快取
+func invalidateRenderCache(problemID uint) {
+	renderCacheMu.Lock()
+	delete(renderCache, problemID)
+	renderCacheMu.Unlock()
+}
@@ -0,0 +1,294 @@
+package views
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/models"
+	"github.com/gin-gonic/gin"
+)
+
+// problemSnapshot 題目版本記錄的內容：題目資料、範例、tag 與語言限制
+func problemSnapshot(problem *models.Problem) (snapshot string, err error) {
+	var pkg problemPackage
+
+	if pkg, err = problemPackageData(problem); err != nil {
+		return
+	}
+	return packageSnapshot(pkg)
+}
+
+// packageSnapshot 題目資料的版本記錄內容
+func packageSnapshot(pkg problemPackage) (snapshot string, err error) {
+	var body []byte
+
+	// validator 與 test case 不屬於題目版本，tag 的順序沒有意義
+	pkg.Validator = nil
+	pkg.Tags = append([]string(nil), pkg.Tags...)
+	sort.Strings(pkg.Tags)
+	if body, err = json.Marshal(pkg); err != nil {
+		return
+	}
+	return string(body), nil
+}
+
+// recordProblemRevision 記錄題目目前的內容為新版本，內容未改變時不新增
+func recordProblemRevision(problem *models.Problem, author, restoredFrom uint) (err error) {
+	var revision models.ProblemRevision
+
+	if revision.Snapshot, err = problemSnapshot(problem); err != nil {
+		return
+	}
+	revision.ProblemID = problem.ID
+	revision.Author = author
+	revision.RestoredFrom = restoredFrom
+	_, err = models.AddProblemRevision(&revision)
+	return
+}
+
+// recordBaselineRevision 題目在有版本記錄前建立時，修改前先以作者記錄原本的內容
+func recordBaselineRevision(problem *models.Problem) (err error) {
+	var has bool
+
+	if has, err = models.HasProblemRevision(problem.ID); err != nil || has {
+		return
+	}
+	return recordProblemRevision(problem, problem.Author, 0)
+}
+
+// getRevisionProblem 讀取 url 中的題目，失敗時回傳錯誤訊息
+func getRevisionProblem(c *gin.Context) (problem models.Problem, ok bool) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "problem id is invalid",
+		})
+		return
+	}
+	if problem, err = models.GetProblemByID(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "無此題目",
+		})
+		return
+	}
+	return problem, true
+}
+
+// getRevision 讀取 problem 的 version 版本並解析快照
+func getRevision(c *gin.Context, problemID uint, version string) (revision models.ProblemRevision, pkg problemPackage, ok bool) {
+	v, err := strconv.Atoi(version)
+	if err != nil || v <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "version is invalid",
+		})
+		return
+	}
+	if revision, err = models.GetProblemRevision(problemID, uint(v)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "無此版本",
+		})
+		return
+	}
+	if err = json.Unmarshal([]byte(revision.Snapshot), &pkg); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+			"error":   err.Error(),
+		})
+		return
+	}
+	return revision, pkg, true
+}
+
+// diffSnapshots 比對兩個版本，回傳有改變的欄位
+func diffSnapshots(from, to *problemPackage) ([]gin.H, error) {
+	var fromFields, toFields map[string]interface{}
+	var diff = make([]gin.H, 0)
+
+	for _, v := range []struct {
+		pkg    *problemPackage
+		fields *map[string]interface{}
+	}{{from, &fromFields}, {to, &toFields}} {
+		body, err := json.Marshal(v.pkg)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(body, v.fields); err != nil {
+			return nil, err
+		}
+	}
+
+	names := make([]string, 0, len(toFields))
+	for name := range toFields {
+		names = append(names, name)
+	}
+	for name := range fromFields {
+		if _, ok := toFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == "format_version" || reflect.DeepEqual(fromFields[name], toFields[name]) {
+			continue
+		}
+		diff = append(diff, gin.H{
+			"field": name,
+			"from":  fromFields[name],
+			"to":    toFields[name],
+		})
+	}
+	return diff, nil
+}
+
+// ListProblemRevisions 列出題目所有版本
+func ListProblemRevisions(c *gin.Context) {
+	var revisions []models.ProblemRevision
+	var err error
+	var returnData = make([]gin.H, 0)
+
+	problem, ok := getRevisionProblem(c)
+	if !ok {
+		return
+	}
+	if revisions, err = models.GetProblemRevisions(problem.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	for _, revision := range revisions {
+		returnData = append(returnData, gin.H{
+			"version":       revision.Version,
+			"author":        revision.Author,
+			"created_at":    revision.CreatedAt,
+			"restored_from": revision.RestoredFrom,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"problem_id": problem.ID,
+		"revisions":  returnData,
+	})
+}
+
+// GetProblemRevision 取得題目特定版本的內容
+func GetProblemRevision(c *gin.Context) {
+	problem, ok := getRevisionProblem(c)
+	if !ok {
+		return
+	}
+	revision, pkg, ok := getRevision(c, problem.ID, c.Params.ByName("version"))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"problem_id":    problem.ID,
+		"version":       revision.Version,
+		"author":        revision.Author,
+		"created_at":    revision.CreatedAt,
+		"restored_from": revision.RestoredFrom,
+		"problem":       pkg,
+	})
+}
+
+// DiffProblemRevisions 比對題目的兩個版本，from 與 to 為版本號
+func DiffProblemRevisions(c *gin.Context) {
+	problem, ok := getRevisionProblem(c)
+	if !ok {
+		return
+	}
+	from, fromPkg, ok := getRevision(c, problem.ID, c.Query("from"))
+	if !ok {
+		return
+	}
+	to, toPkg, ok := getRevision(c, problem.ID, c.Query("to"))
+	if !ok {
+		return
+	}
+
+	diff, err := diffSnapshots(&fromPkg, &toPkg)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"problem_id": problem.ID,
+		"from":       from.Version,
+		"to":         to.Version,
+		"changes":    diff,
+	})
+}
+
+// RestoreProblemRevision 將題目還原為特定版本，並記錄為新版本
+func RestoreProblemRevision(c *gin.Context) {
+	var err error
+	userID := c.MustGet("userID").(uint)
+
+	problem, ok := getRevisionProblem(c)
+	if !ok {
+		return
+	}
+	revision, pkg, ok := getRevision(c, problem.ID, c.Params.ByName("version"))
+	if !ok {
+		return
+	}
+
+	setProblemFromPackage(&problem, &pkg)
+	content := models.ProblemContent{Tags: pkg.Tags}
+	for i, s := range pkg.Samples {
+		content.Samples = append(content.Samples, models.Sample{Input: s.Input, Output: s.Output, Sort: uint(i + 1)})
+	}
+	for _, language := range pkg.Languages {
+		content.Languages = append(content.Languages, models.ProblemLanguage{
+			Language:    language.Language,
+			CPUTime:     language.CPUTime,
+			MemoryLimit: language.MemoryLimit,
+		})
+	}
+	for _, t := range pkg.Translations {
+		content.Translations = append(content.Translations, models.ProblemTranslation{
+			Locale:            t.Locale,
+			ProblemName:       t.ProblemName,
+			Description:       t.Description,
+			InputDescription:  t.InputDescription,
+			OutputDescription: t.OutputDescription,
+		})
+	}
+
+	// 還原後的內容即為快照的內容，題目本身的欄位以還原後的題目為準
+	restored := problemPackageFields(&problem)
+	restored.Tags = pkg.Tags
+	restored.Samples = pkg.Samples
+	restored.Languages = pkg.Languages
+	restored.Translations = pkg.Translations
+	restoredRevision := models.ProblemRevision{ProblemID: problem.ID, Author: userID, RestoredFrom: revision.Version}
+	if restoredRevision.Snapshot, err = packageSnapshot(restored); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "題目還原失敗-伺服器錯誤-revision",
+		})
+		return
+	}
+
+	if err = models.RestoreProblemRevision(&problem, &content, &restoredRevision); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "題目還原失敗-伺服器錯誤",
+		})
+		return
+	}
+	invalidateRenderCache(problem.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "題目還原成功",
+		"problem_id":    problem.ID,
+		"restored_from": revision.Version,
+	})
+}
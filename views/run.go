@@ -0,0 +1,216 @@
+package views
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/judgeservice"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/models"
+	"github.com/gin-gonic/gin"
+	"github.com/vincentinttsh/zero"
+)
+
+// customRunTTL 自訂輸入執行結果保留的時間
+const customRunTTL = time.Hour
+
+// customRunInputLimit 自訂輸入的大小上限
+const customRunInputLimit = 64 * 1024
+
+// customRunLimit 每位使用者每分鐘可建立的自訂輸入執行數
+var customRunLimit int64 = 10
+
+// getCustomRun 讀取 url 中的自訂輸入執行，過期的執行視為不存在
+func getCustomRun(c *gin.Context) (run models.CustomRun, ok bool) {
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "run id is invalid",
+		})
+		return
+	}
+
+	if run, err = models.GetCustomRun(uint(id)); err != nil || time.Since(run.CreatedAt) > customRunTTL {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "無此執行",
+		})
+		return
+	}
+	return run, true
+}
+
+// CreateCustomRun 以自訂輸入執行程式，不建立提交
+func CreateCustomRun(c *gin.Context) {
+	var data customRunAPIRequest
+	var run models.CustomRun
+	var runTask judgeservice.RunTask
+	var problem models.Problem
+	var count int64
+	var ok bool
+	userID := c.MustGet("userID").(uint)
+
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "problem id is invalid",
+		})
+		return
+	}
+
+	if problem, ok = getVisibleProblem(c, uint(id)); !ok {
+		return
+	}
+
+	if err = c.BindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "未按照格式填寫或未使用json",
+		})
+		return
+	}
+	if zero.IsZero(data) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "未填寫完成",
+		})
+		return
+	}
+	if len(*data.Input) > customRunInputLimit {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "input is too large",
+		})
+		return
+	}
+
+	if _, allowed, err := problemLanguage(problem.ID, *data.Language); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	} else if !allowed {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "language is not allowed in this problem",
+		})
+		return
+	}
+
+	if count, err = models.CountUserCustomRuns(userID, time.Now().Add(-time.Minute)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+	if count >= customRunLimit {
+		c.Header("Retry-After", "60")
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"message": "執行次數過多，請稍後再試",
+		})
+		return
+	}
+
+	run.ProblemID = problem.ID
+	run.Author = userID
+	run.Language = *data.Language
+	run.SourceCode = *data.SourceCode
+	run.Input = *data.Input
+
+	// 與正式評測使用相同的時間與記憶體限制
+	judgeTask, err := newJudgeTask(&problem, &models.Submission{Language: run.Language})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+	runTask.SourceCode = run.SourceCode
+	runTask.Language = run.Language
+	runTask.CPUTime = judgeTask.CPUTime
+	runTask.MemoryLimit = judgeTask.MemoryLimit
+	runTask.ProgramName = judgeTask.ProgramName
+	runTask.Input = run.Input
+	if err = runTask.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err = models.AddCustomRun(&run); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	runTask.RunID = run.ID
+	if err = runTask.Run(getOutbox(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "執行中",
+		"run_id":  run.ID,
+	})
+}
+
+// GetCustomRun 讀取自訂輸入執行結果，只有建立者可以讀取
+func GetCustomRun(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	run, ok := getCustomRun(c)
+	if !ok {
+		return
+	}
+	if run.Author != userID {
+		c.JSON(http.StatusForbidden, gin.H{
+			"message": "權限不足",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"run_id":   run.ID,
+		"finished": run.Finished,
+		"status":   run.Status,
+		"stdout":   run.Stdout,
+		"stderr":   run.Stderr,
+		"cpu_time": run.CPUTime,
+		"memory":   run.Memory,
+	})
+}
+
+// UpdateCustomRunResult update custom input run result - judge service
+func UpdateCustomRunResult(c *gin.Context) {
+	var data models.RunResult
+
+	run, ok := getCustomRun(c)
+	if !ok {
+		return
+	}
+
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "json error",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if err := models.UpdateCustomRunResult(run.ID, &data); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "system error",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "update success",
+	})
+}
+
+// purgeCustomRuns 刪除過期的自訂輸入執行
+func purgeCustomRuns() (int64, error) {
+	return models.DeleteCustomRuns(time.Now().Add(-customRunTTL))
+}
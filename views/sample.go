@@ -0,0 +1,232 @@
+package views
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/judgeservice"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/models"
+	"github.com/gin-gonic/gin"
+)
+
+// sampleDiffLimit 每個範例最多回傳的不同行數
+const sampleDiffLimit = 20
+
+func newSampleTask(problem *models.Problem, submission *models.Submission, samples []models.SampleData) (sampleTask judgeservice.SampleTask, err error) {
+	judgeTask, err := newJudgeTask(problem, submission)
+	if err != nil {
+		return
+	}
+
+	sampleTask.SubmissionID = submission.ID
+	sampleTask.SourceCode = submission.SourceCode
+	sampleTask.Language = submission.Language
+	sampleTask.CPUTime = judgeTask.CPUTime
+	sampleTask.MemoryLimit = judgeTask.MemoryLimit
+	sampleTask.ProgramName = judgeTask.ProgramName
+	sampleTask.Priority = judgeTask.Priority
+	for _, sample := range samples {
+		sampleTask.Samples = append(sampleTask.Samples, judgeservice.SampleCase{
+			Sort:   sample.Sort,
+			Input:  sample.Input,
+			Output: sample.Output,
+		})
+	}
+	return
+}
+
+// dispatchFullJudge 範例通過或使用者確認後，在更新預先檢查狀態的 transaction 中寫入完整評測的 task
+func dispatchFullJudge(w *models.OutboxWriter, submission *models.Submission) error {
+	problem, err := models.GetProblemByID(submission.ProblemID)
+	if err != nil {
+		return err
+	}
+
+	judgeTask, err := newJudgeTask(&problem, submission)
+	if err != nil {
+		return err
+	}
+	return judgeTask.Run(w)
+}
+
+// applySampleResult 更新範例預先檢查結果，全部通過時送出完整評測，重複的結果不會重複處理
+func applySampleResult(outbox outboxPublisher, submissionID uint, data *models.SampleCheckResult) (err error) {
+	written, err := models.UpdateSampleResults(submissionID, data, dispatchFullJudge)
+	if err != nil {
+		if err == models.ErrAlreadyRated {
+			return nil
+		}
+		return
+	}
+
+	// 送出失敗的 task 已在 outbox 中，由 relay 重送
+	outbox.deliver(written)
+	return nil
+}
+
+// diffLines 逐行比對預期輸出與實際輸出，忽略結尾的換行
+func diffLines(expected, actual string) []gin.H {
+	var diff = make([]gin.H, 0)
+
+	expectedLines := strings.Split(strings.TrimRight(expected, "\r\n"), "\n")
+	actualLines := strings.Split(strings.TrimRight(actual, "\r\n"), "\n")
+
+	for i := 0; i < len(expectedLines) || i < len(actualLines); i++ {
+		var e, a string
+		if i < len(expectedLines) {
+			e = strings.TrimRight(expectedLines[i], "\r")
+		}
+		if i < len(actualLines) {
+			a = strings.TrimRight(actualLines[i], "\r")
+		}
+		if e == a {
+			continue
+		}
+		if len(diff) == sampleDiffLimit {
+			break
+		}
+		diff = append(diff, gin.H{
+			"line":     i + 1,
+			"expected": e,
+			"actual":   a,
+		})
+	}
+	return diff
+}
+
+// getOwnSubmission 讀取 url 中屬於目前使用者的提交
+func getOwnSubmission(c *gin.Context) (submission models.Submission, ok bool) {
+	userID := c.MustGet("userID").(uint)
+
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "submission id is invalid",
+		})
+		return
+	}
+
+	if submission, err = models.GetSubmission(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "無此提交",
+		})
+		return
+	}
+	if submission.Author != userID {
+		c.JSON(http.StatusForbidden, gin.H{
+			"message": "權限不足",
+		})
+		return
+	}
+	return submission, true
+}
+
+// GetSubmissionSampleResult 讀取提交在範例上的執行結果與差異
+func GetSubmissionSampleResult(c *gin.Context) {
+	var samples []models.SampleData
+	var results []models.SampleResult
+	var err error
+	var returnData = make([]gin.H, 0)
+
+	submission, ok := getOwnSubmission(c)
+	if !ok {
+		return
+	}
+
+	if samples, err = models.GetProblemSortedSamples(submission.ProblemID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+	if results, err = models.GetSampleResults(submission.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	expected := make(map[uint]models.SampleData, len(samples))
+	for _, sample := range samples {
+		expected[sample.Sort] = sample
+	}
+	for _, result := range results {
+		sample := expected[result.Sort]
+		returnData = append(returnData, gin.H{
+			"sort":     result.Sort,
+			"status":   result.Status,
+			"input":    sample.Input,
+			"expected": sample.Output,
+			"actual":   result.Output,
+			"diff":     diffLines(sample.Output, result.Output),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"submission_id": submission.ID,
+		"precheck":      submission.Precheck,
+		"samples":       returnData,
+	})
+}
+
+// ConfirmSubmission 範例未通過時，使用者確認仍要送出完整評測
+func ConfirmSubmission(c *gin.Context) {
+	submission, ok := getOwnSubmission(c)
+	if !ok {
+		return
+	}
+
+	written, err := models.ConfirmSubmissionPrecheck(submission.ID, dispatchFullJudge)
+	if err != nil {
+		if err == models.ErrNotPrecheckFailed {
+			c.JSON(http.StatusConflict, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+	getOutbox(c).deliver(written)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "已送出評測",
+		"submission_id": submission.ID,
+	})
+}
+
+// UpdateSubmissionSampleResult update submission sample pre-check result - judge service
+func UpdateSubmissionSampleResult(c *gin.Context) {
+	var data models.SampleCheckResult
+
+	submissionID, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "submission id is invalid",
+		})
+		return
+	}
+
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "json error",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if err := applySampleResult(getOutbox(c), uint(submissionID), &data); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "system error",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "update success",
+	})
+}
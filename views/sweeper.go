@@ -0,0 +1,178 @@
+package views
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/judgeservice"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/models"
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/queue"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// sweeperMetrics 逾時提交重新送出的統計
+type sweeperMetrics struct {
+	mu          sync.Mutex
+	Sweeps      uint64
+	Requeued    uint64
+	Failed      uint64
+	LastStuck   int
+	LastSweepAt time.Time
+	LastError   string
+}
+
+var sweeper sweeperMetrics
+
+// errNotClaimed 提交已有結果或已被其他 sweeper 重新送出
+var errNotClaimed = errors.New("submission is not claimed")
+
+// SweepStuckSubmissions 找出送出超過 threshold 仍未評測完成的提交並重新送出評測，
+// 已重送 maxAttempts 次的提交標記為 system error
+// lane 中仍有待評測的 task 時，該 lane 的提交可能仍在排隊，不視為逾時
+func SweepStuckSubmissions(q queue.TaskQueue, threshold time.Duration, maxAttempts uint) (requeued, failed int, err error) {
+	var submissions []models.Submission
+
+	defer func() {
+		sweeper.mu.Lock()
+		defer sweeper.mu.Unlock()
+
+		sweeper.Sweeps++
+		sweeper.Requeued += uint64(requeued)
+		sweeper.Failed += uint64(failed)
+		sweeper.LastStuck = len(submissions)
+		sweeper.LastSweepAt = time.Now()
+		sweeper.LastError = ""
+		if err != nil {
+			sweeper.LastError = err.Error()
+		}
+	}()
+
+	before := time.Now().Add(-threshold)
+	if submissions, err = models.GetStuckSubmissions(before); err != nil {
+		return
+	}
+
+	busy := make(map[string]bool)
+	for _, lane := range judgeservice.Lanes {
+		var info queue.QueueInfo
+
+		if info, err = q.Inspect(lane); err != nil {
+			return
+		}
+		busy[lane] = info.Messages > 0
+	}
+
+	// 單筆提交失敗時記錄錯誤並繼續處理其他提交，回傳最後一個錯誤
+	outbox := outboxPublisher{queue: q}
+	problems := make(map[uint]models.Problem)
+	for i := range submissions {
+		if busy[judgeservice.LaneOf(submissionPriority(&submissions[i]))] {
+			continue
+		}
+		sent, rowErr := sweepSubmission(outbox, &submissions[i], before, maxAttempts, problems)
+		if errors.Is(rowErr, errNotClaimed) {
+			continue
+		}
+		if rowErr != nil {
+			log.Printf("sweep submission %d: %v", submissions[i].ID, rowErr)
+			err = rowErr
+			continue
+		}
+		if sent {
+			requeued++
+		} else {
+			failed++
+		}
+	}
+	return
+}
+
+// sweepSubmission 重新送出一筆逾時的提交，sent 為 false 表示已標記為 system error
+// 超過重送次數或題目已刪除的提交標記為 system error，範例預先檢查中的提交重新送出範例執行
+// 重新送出前先 claim 提交，避免多個 sweeper 重複送出
+func sweepSubmission(outbox outboxPublisher, submission *models.Submission, before time.Time, maxAttempts uint, problems map[uint]models.Problem) (sent bool, err error) {
+	if submission.Attempts >= maxAttempts {
+		return false, models.MarkSubmissionSystemError(submission.ID)
+	}
+
+	problem, ok := problems[submission.ProblemID]
+	if !ok {
+		problem, err = models.GetProblemByID(submission.ProblemID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, models.MarkSubmissionSystemError(submission.ID)
+		} else if err != nil {
+			return
+		}
+		problems[submission.ProblemID] = problem
+	}
+
+	claimed, err := models.ClaimStuckSubmission(submission.ID, before)
+	if err != nil {
+		return
+	}
+	if !claimed {
+		return false, errNotClaimed
+	}
+	if submission.Precheck == models.PrecheckPending {
+		samples, err := models.GetProblemSortedSamples(problem.ID)
+		if err != nil {
+			return false, err
+		}
+		if len(samples) > 0 {
+			sampleTask, err := newSampleTask(&problem, submission, samples)
+			if err != nil {
+				return false, err
+			}
+			return true, sampleTask.Run(outbox)
+		}
+	}
+	judgeTask, err := newJudgeTask(&problem, submission)
+	if err != nil {
+		return
+	}
+	return true, judgeTask.Run(outbox)
+}
+
+// StartSweeper 每隔 interval 檢查一次逾時的提交並清除過期的自訂輸入執行，直到 stop 被關閉
+func StartSweeper(q queue.TaskQueue, interval, threshold time.Duration, maxAttempts uint, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				requeued, failed, err := SweepStuckSubmissions(q, threshold, maxAttempts)
+				if err != nil {
+					log.Println("sweep stuck submissions:", err)
+				} else if needLog || requeued > 0 || failed > 0 {
+					log.Printf("sweep stuck submissions: %d requeued, %d failed", requeued, failed)
+				}
+				if _, err := purgeCustomRuns(); err != nil {
+					log.Println("purge custom runs:", err)
+				}
+			}
+		}
+	}()
+}
+
+// GetSweeperMetrics 逾時提交重新送出的統計
+func GetSweeperMetrics(c *gin.Context) {
+	sweeper.mu.Lock()
+	defer sweeper.mu.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"sweeps":        sweeper.Sweeps,
+		"requeued":      sweeper.Requeued,
+		"failed":        sweeper.Failed,
+		"last_stuck":    sweeper.LastStuck,
+		"last_sweep_at": sweeper.LastSweepAt,
+		"last_error":    sweeper.LastError,
+	})
+}
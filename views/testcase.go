@@ -0,0 +1,233 @@
+package views
+
+import (
+	"mime/multipart"
+	"net/http"
+	"strconv"
+
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/models"
+	"github.com/gin-gonic/gin"
+)
+
+// getTestCaseProblem 讀取 url 中的 problem 與其目前所有的 test case
+func getTestCaseProblem(c *gin.Context) (problem models.Problem, cases []testCase, ok bool) {
+	var id int
+	var err error
+
+	if id, err = strconv.Atoi(c.Params.ByName("id")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "problem id is invalid",
+		})
+		return
+	}
+
+	if problem, err = models.GetProblemByID(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "無此題目",
+		})
+		return
+	}
+
+	if cases, err = loadTestCases(problem.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "server error",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	return problem, cases, true
+}
+
+// getTestCaseIndex 讀取 url 中的 test case 編號，回傳其在 cases 中的 index
+func getTestCaseIndex(c *gin.Context, cases []testCase) (index int, ok bool) {
+	number, err := strconv.Atoi(c.Params.ByName("case"))
+	if err != nil || number < 1 || number > len(cases) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "無此 test case",
+		})
+		return
+	}
+	return number - 1, true
+}
+
+// saveEditedTestCases 儲存編輯後的 test case，並依 rejudge 參數重新評測
+func saveEditedTestCases(c *gin.Context, problem *models.Problem, cases []testCase, status int) {
+	var info testCaseInfo
+	var normalized map[string][]string
+	var rejudged, referenceRuns int
+	var validating bool
+	var err error
+	outbox := getOutbox(c)
+
+	if info, normalized, err = saveTestCases(problem, cases); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "server error",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if validating, err = updateTestCaseStatus(outbox, problem, info.TestCaseNumber); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "server error",
+		})
+		return
+	}
+
+	if info.TestCaseNumber > 0 {
+		if referenceRuns, err = runReferenceSolutions(outbox, problem); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"message": "reference solution run failed",
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
+
+	if c.Query("rejudge") == "true" {
+		if rejudged, err = rejudgeProblem(outbox, problem); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"message": "rejudge failed",
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
+
+	c.JSON(status, gin.H{
+		"message":          "更新成功",
+		"problem_id":       problem.ID,
+		"test_case_number": info.TestCaseNumber,
+		"test_cases":       info.TestCases,
+		"normalized":       normalized,
+		"rejudged":         rejudged,
+		"validating":       validating,
+		"reference_runs":   referenceRuns,
+	})
+}
+
+// readTestCaseForm 讀取 form 中的 input / output 檔案，未上傳的檔案回傳 nil
+func readTestCaseForm(c *gin.Context) (input, output []byte, err error) {
+	var file *multipart.FileHeader
+
+	if file, err = c.FormFile("input"); err == nil {
+		if input, err = readFormFile(file, uploadSizeLimit); err != nil {
+			return
+		}
+	} else if err != http.ErrMissingFile {
+		return
+	}
+
+	if file, err = c.FormFile("output"); err == nil {
+		if output, err = readFormFile(file, uploadSizeLimit); err != nil {
+			return
+		}
+	} else if err != http.ErrMissingFile {
+		return
+	}
+
+	return input, output, nil
+}
+
+// AddProblemTestCase 新增一筆 test case 於最後
+func AddProblemTestCase(c *gin.Context) {
+	problem, cases, ok := getTestCaseProblem(c)
+	if !ok {
+		return
+	}
+
+	input, output, err := readTestCaseForm(c)
+	if err != nil || input == nil || output == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "input and output file are required",
+		})
+		return
+	}
+
+	cases = append(cases, testCase{Input: input, Output: output})
+	saveEditedTestCases(c, &problem, cases, http.StatusCreated)
+}
+
+// ReplaceProblemTestCase 取代一筆 test case 的 input 或 output
+func ReplaceProblemTestCase(c *gin.Context) {
+	problem, cases, ok := getTestCaseProblem(c)
+	if !ok {
+		return
+	}
+	index, ok := getTestCaseIndex(c, cases)
+	if !ok {
+		return
+	}
+
+	input, output, err := readTestCaseForm(c)
+	if err != nil || (input == nil && output == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "input or output file is required",
+		})
+		return
+	}
+
+	if input != nil {
+		cases[index].Input = input
+		cases[index].InputStored = false
+	}
+	if output != nil {
+		cases[index].Output = output
+		cases[index].OutputStored = false
+	}
+	saveEditedTestCases(c, &problem, cases, http.StatusOK)
+}
+
+// DeleteProblemTestCase 刪除一筆 test case，之後的 test case 編號往前遞補
+func DeleteProblemTestCase(c *gin.Context) {
+	problem, cases, ok := getTestCaseProblem(c)
+	if !ok {
+		return
+	}
+	index, ok := getTestCaseIndex(c, cases)
+	if !ok {
+		return
+	}
+
+	cases = append(cases[:index], cases[index+1:]...)
+	saveEditedTestCases(c, &problem, cases, http.StatusOK)
+}
+
+// ReorderProblemTestCase 重新排序 test case
+func ReorderProblemTestCase(c *gin.Context) {
+	var data testCaseOrderAPIRequest
+
+	problem, cases, ok := getTestCaseProblem(c)
+	if !ok {
+		return
+	}
+
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "json format error",
+		})
+		return
+	}
+
+	// order 必須是 1 ~ n 的排列
+	seen := make(map[int]bool, len(data.Order))
+	for _, number := range data.Order {
+		if number < 1 || number > len(cases) || seen[number] {
+			break
+		}
+		seen[number] = true
+	}
+	if len(data.Order) != len(cases) || len(seen) != len(cases) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "order must be a permutation of test case numbers",
+		})
+		return
+	}
+
+	reordered := make([]testCase, 0, len(cases))
+	for _, number := range data.Order {
+		reordered = append(reordered, cases[number-1])
+	}
+	saveEditedTestCases(c, &problem, reordered, http.StatusOK)
+}
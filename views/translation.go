@@ -0,0 +1,425 @@
+package views
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/models"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/vincentinttsh/replace"
+	"gorm.io/gorm"
+)
+
+// localePattern 語言標籤，例如 zh-TW、en、zh-Hant-TW
+var localePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// normalizeLocale 檢查語言標籤並統一大小寫，例如 zh-tw 轉為 zh-TW
+func normalizeLocale(locale string) (string, bool) {
+	if len(locale) > 16 || !localePattern.MatchString(locale) {
+		return "", false
+	}
+	parts := strings.Split(locale, "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		switch len(parts[i]) {
+		case 2:
+			parts[i] = strings.ToUpper(parts[i])
+		case 4:
+			parts[i] = strings.ToUpper(parts[i][:1]) + strings.ToLower(parts[i][1:])
+		default:
+			parts[i] = strings.ToLower(parts[i])
+		}
+	}
+	return strings.Join(parts, "-"), true
+}
+
+// acceptLanguages 依 q 值排序 Accept-Language 中的語言，忽略無法辨識與 q=0 的語言
+func acceptLanguages(header string) (locales []string) {
+	type weighted struct {
+		locale string
+		q      float64
+	}
+	var list []weighted
+
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		locale, ok := normalizeLocale(strings.TrimSpace(fields[0]))
+		if !ok {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			list = append(list, weighted{locale, q})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].q > list[j].q
+	})
+
+	for _, w := range list {
+		locales = append(locales, w.locale)
+	}
+	return
+}
+
+// matchLocale 從 available 選出最符合 wanted 的語言，先比對完整標籤再比對主要語言，沒有符合時回傳空字串
+func matchLocale(wanted, available []string) string {
+	primary := func(locale string) string {
+		return strings.SplitN(locale, "-", 2)[0]
+	}
+	for _, w := range wanted {
+		for _, a := range available {
+			if a == w {
+				return a
+			}
+		}
+		for _, a := range available {
+			if primary(a) == primary(w) {
+				return a
+			}
+		}
+	}
+	return ""
+}
+
+// localizeProblem 依 locale 參數或 Accept-Language 以翻譯取代 problem 的敘述，翻譯中空白的欄位使用預設語言
+// 回傳選擇的語言與題目所有的語言，預設語言排在第一個
+func localizeProblem(c *gin.Context, problem *models.Problem) (locale string, locales []string, err error) {
+	var translations []models.ProblemTranslation
+	var wanted []string
+
+	if translations, err = models.GetProblemTranslations(problem.ID); err != nil {
+		return
+	}
+	locales = []string{problem.StatementLocale()}
+	for _, t := range translations {
+		locales = append(locales, t.Locale)
+	}
+
+	if q, ok := normalizeLocale(c.Query("locale")); ok {
+		wanted = []string{q}
+	} else {
+		wanted = acceptLanguages(c.GetHeader("Accept-Language"))
+	}
+	c.Header("Vary", "Accept-Language")
+	if locale = matchLocale(wanted, locales); locale == "" {
+		locale = locales[0]
+	}
+
+	for _, t := range translations {
+		if t.Locale != locale {
+			continue
+		}
+		for _, field := range []struct {
+			dst *string
+			src string
+		}{
+			{&problem.ProblemName, t.ProblemName},
+			{&problem.Description, t.Description},
+			{&problem.InputDescription, t.InputDescription},
+			{&problem.OutputDescription, t.OutputDescription},
+		} {
+			if field.src != "" {
+				*field.dst = field.src
+			}
+		}
+	}
+	return
+}
+
+// checkPackageTranslations 檢查 problem package 翻譯的語言標籤，不可重複或與預設語言相同
+func checkPackageTranslations(pkg *problemPackage) error {
+	seen := map[string]bool{}
+	if pkg.DefaultLocale != "" {
+		locale, ok := normalizeLocale(pkg.DefaultLocale)
+		if !ok || locale != pkg.DefaultLocale {
+			return fmt.Errorf("default_locale %q is invalid", pkg.DefaultLocale)
+		}
+		seen[locale] = true
+	}
+	for _, t := range pkg.Translations {
+		locale, ok := normalizeLocale(t.Locale)
+		if !ok || locale != t.Locale {
+			return fmt.Errorf("translation locale %q is invalid", t.Locale)
+		}
+		if seen[locale] {
+			return fmt.Errorf("translation locale %q is duplicated", t.Locale)
+		}
+		seen[locale] = true
+	}
+	return nil
+}
+
+// saveProblemTranslations 以 translations 取代題目所有的翻譯
+func saveProblemTranslations(problemID uint, translations []packageTranslation) (err error) {
+	if err = models.DeleteProblemAllTranslations(problemID); err != nil {
+		return
+	}
+	for _, t := range translations {
+		translation := models.ProblemTranslation{
+			ProblemID:         problemID,
+			Locale:            t.Locale,
+			ProblemName:       t.ProblemName,
+			Description:       t.Description,
+			InputDescription:  t.InputDescription,
+			OutputDescription: t.OutputDescription,
+		}
+		if err = models.SetProblemTranslation(&translation); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// getTranslationTarget 讀取 url 中的題目與語言，語言不可為題目的預設語言
+func getTranslationTarget(c *gin.Context) (problem models.Problem, locale string, ok bool) {
+	if problem, ok = getRevisionProblem(c); !ok {
+		return
+	}
+	if locale, ok = normalizeLocale(c.Params.ByName("locale")); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "locale is invalid",
+		})
+		return
+	}
+	if locale == problem.StatementLocale() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "預設語言的敘述請直接編輯題目",
+		})
+		return problem, locale, false
+	}
+	return
+}
+
+// ListProblemTranslations 列出題目的預設語言與所有翻譯
+func ListProblemTranslations(c *gin.Context) {
+	var returnData = make([]gin.H, 0)
+
+	problem, ok := getRevisionProblem(c)
+	if !ok {
+		return
+	}
+	translations, err := models.GetProblemTranslations(problem.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	for _, t := range translations {
+		returnData = append(returnData, gin.H{
+			"locale":             t.Locale,
+			"problem_name":       t.ProblemName,
+			"description":        t.Description,
+			"input_description":  t.InputDescription,
+			"output_description": t.OutputDescription,
+			"updated_at":         t.UpdatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"problem_id":     problem.ID,
+		"default_locale": problem.StatementLocale(),
+		"translations":   returnData,
+	})
+}
+
+// SetProblemTranslation 新增或編輯題目在 locale 的翻譯，只更新有填寫的欄位
+func SetProblemTranslation(c *gin.Context) {
+	var data translationAPIRequest
+	userID := c.MustGet("userID").(uint)
+
+	problem, locale, ok := getTranslationTarget(c)
+	if !ok {
+		return
+	}
+	if err := c.ShouldBindBodyWith(&data, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "未按照格式填寫或未使用json",
+		})
+		return
+	}
+	if data.ProblemName == nil && data.Description == nil && data.InputDescription == nil && data.OutputDescription == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "未填寫完成",
+		})
+		return
+	}
+
+	translation, err := models.GetProblemTranslation(problem.ID, locale)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+	if err = recordBaselineRevision(&problem); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "翻譯設定失敗-伺服器錯誤-revision",
+		})
+		return
+	}
+
+	replace.Replace(&translation, &data)
+	translation.ProblemID = problem.ID
+	translation.Locale = locale
+	if err = models.SetProblemTranslation(&translation); err == nil {
+		invalidateRenderCache(problem.ID)
+		err = recordProblemRevision(&problem, userID, 0)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "翻譯設定失敗-伺服器錯誤",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "翻譯設定成功",
+		"problem_id": problem.ID,
+		"locale":     locale,
+	})
+}
+
+// DeleteProblemTranslation 刪除題目在 locale 的翻譯
+func DeleteProblemTranslation(c *gin.Context) {
+	userID := c.MustGet("userID").(uint)
+
+	problem, locale, ok := getTranslationTarget(c)
+	if !ok {
+		return
+	}
+	if err := recordBaselineRevision(&problem); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "翻譯刪除失敗-伺服器錯誤-revision",
+		})
+		return
+	}
+
+	if err := models.DeleteProblemTranslation(problem.ID, locale); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"message": "無此翻譯",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+	invalidateRenderCache(problem.ID)
+	if err := recordProblemRevision(&problem, userID, 0); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "翻譯刪除失敗-伺服器錯誤-revision",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "翻譯刪除成功",
+		"problem_id": problem.ID,
+		"locale":     locale,
+	})
+}
+
+// SetProblemDefaultLocale 設定題目的預設語言
+// 該語言已有翻譯時與題目本身的敘述交換，原本的敘述成為原預設語言的翻譯
+func SetProblemDefaultLocale(c *gin.Context) {
+	var data struct {
+		Locale string `json:"locale"`
+	}
+	userID := c.MustGet("userID").(uint)
+
+	problem, ok := getRevisionProblem(c)
+	if !ok {
+		return
+	}
+	if err := c.ShouldBindBodyWith(&data, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "未按照格式填寫或未使用json",
+		})
+		return
+	}
+	locale, ok := normalizeLocale(data.Locale)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "locale is invalid",
+		})
+		return
+	}
+	if err := recordBaselineRevision(&problem); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "預設語言設定失敗-伺服器錯誤-revision",
+		})
+		return
+	}
+
+	oldLocale := problem.StatementLocale()
+	if locale != oldLocale {
+		var previous *models.ProblemTranslation
+
+		translation, err := models.GetProblemTranslation(problem.ID, locale)
+		if err == nil {
+			previous = &models.ProblemTranslation{
+				ProblemID:         problem.ID,
+				Locale:            oldLocale,
+				ProblemName:       problem.ProblemName,
+				Description:       problem.Description,
+				InputDescription:  problem.InputDescription,
+				OutputDescription: problem.OutputDescription,
+			}
+			// 翻譯未填寫的欄位沿用原本的敘述，與顯示翻譯時相同
+			for _, field := range []struct {
+				dst *string
+				src string
+			}{
+				{&problem.ProblemName, translation.ProblemName},
+				{&problem.Description, translation.Description},
+				{&problem.InputDescription, translation.InputDescription},
+				{&problem.OutputDescription, translation.OutputDescription},
+			} {
+				if field.src != "" {
+					*field.dst = field.src
+				}
+			}
+		} else if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = nil
+		}
+		problem.DefaultLocale = locale
+		if err == nil {
+			err = models.SetProblemDefaultLocale(&problem, previous)
+		}
+		invalidateRenderCache(problem.ID)
+		if err == nil {
+			err = recordProblemRevision(&problem, userID, 0)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"message": "預設語言設定失敗-伺服器錯誤",
+			})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "預設語言設定成功",
+		"problem_id":     problem.ID,
+		"default_locale": locale,
+	})
+}
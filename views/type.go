@@ -1,5 +1,11 @@
 package views
 
+import (
+	"time"
+
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/models"
+)
+
 type sampleTemplate struct {
 	Input  string `json:"input"`
 	Output string `json:"output"`
@@ -14,6 +20,24 @@ type testCaseTemplate struct {
 	OutputName        string `json:"output_name"`
 }
 
+type testCaseInfo struct {
+	TestCaseNumber int                         `json:"test_case_number"`
+	Spj            bool                        `json:"spj"`
+	TestCases      map[string]testCaseTemplate `json:"test_cases"`
+}
+
+// testCase 一筆 test case，InputStored 與 OutputStored 表示檔案讀取自 storage，儲存時不再正規化
+type testCase struct {
+	Input        []byte
+	Output       []byte
+	InputStored  bool
+	OutputStored bool
+}
+
+type testCaseOrderAPIRequest struct {
+	Order []int `json:"order"`
+}
+
 type problemAPIRequest struct {
 	ProblemName       *string           `json:"problem_name"`
 	Description       *string           `json:"description"`
@@ -27,7 +51,125 @@ type problemAPIRequest struct {
 	ProgramName       *string           `json:"program_name"`
 }
 
+type normalizeTemplate struct {
+	CRLF               *bool `json:"crlf"`
+	BOM                *bool `json:"bom"`
+	TrailingWhitespace *bool `json:"trailing_whitespace"`
+	FinalNewline       *bool `json:"final_newline"`
+}
+
+type problemLanguageTemplate struct {
+	Language    string `json:"language"`
+	CPUTime     uint   `json:"cpu_time"`
+	MemoryLimit uint   `json:"memory_limit"`
+}
+
+// problemOptionAPIRequest problem 選填的設定，與 problemAPIRequest 分開以免影響必填檢查
+type problemOptionAPIRequest struct {
+	Normalize *normalizeTemplate         `json:"normalize"`
+	Languages *[]problemLanguageTemplate `json:"languages"` // 空的列表表示不限制語言
+}
+
+type translationAPIRequest struct {
+	ProblemName       *string `json:"problem_name"`
+	Description       *string `json:"description"`
+	InputDescription  *string `json:"input_description"`
+	OutputDescription *string `json:"output_description"`
+}
+
+// cloneAPIRequest 複製題目時要複製的部分，未填寫時預設複製
+type cloneAPIRequest struct {
+	Copy struct {
+		Samples     *bool `json:"samples"`
+		Tags        *bool `json:"tags"`
+		Languages   *bool `json:"languages"`
+		Validator   *bool `json:"validator"` // 測資驗證程式，評測的比對方式隨題目的 normalize 設定複製
+		TestCases   *bool `json:"test_cases"`
+		Attachments *bool `json:"attachments"` // 附件，題目敘述中的附件連結會指向新題目的附件
+	} `json:"copy"`
+}
+
+type visibilityAPIRequest struct {
+	Visibility *string    `json:"visibility"`
+	PublishAt  *time.Time `json:"publish_at"` // 排程公開的時間，未填寫表示不排程
+	Groups     []uint     `json:"groups"`     // visibility 為 shared 時分享的群組
+	Contests   []uint     `json:"contests"`   // visibility 為 shared 時分享的競賽
+}
+
 type submissionAPIRequest struct {
 	SourceCode *string `json:"source_code"`
 	Language   *string `json:"language"`
 }
+
+type customRunAPIRequest struct {
+	SourceCode *string `json:"source_code"`
+	Language   *string `json:"language"`
+	Input      *string `json:"input"`
+}
+
+type submissionOptionAPIRequest struct {
+	ContestID   uint `json:"contest_id"`
+	SampleFirst bool `json:"sample_first"` // 先執行範例，通過或確認後才送出完整評測
+}
+
+type validatorAPIRequest struct {
+	SourceCode *string `json:"source_code"`
+	Language   *string `json:"language"`
+}
+
+type validationAPIRequest struct {
+	RunID   uint                      `json:"run_id"`
+	Results []models.ValidationResult `json:"results"`
+}
+
+type referenceAPIRequest struct {
+	SourceCode *string `json:"source_code"`
+	Language   *string `json:"language"`
+	Expected   *string `json:"expected"`
+	IsMain     bool    `json:"is_main"`
+}
+
+type packageSample struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+}
+
+type packageNormalize struct {
+	CRLF               bool `json:"crlf"`
+	BOM                bool `json:"bom"`
+	TrailingWhitespace bool `json:"trailing_whitespace"`
+	FinalNewline       bool `json:"final_newline"`
+}
+
+type packageValidator struct {
+	Language   string `json:"language"`
+	SourceCode string `json:"source_code"`
+}
+
+type packageTranslation struct {
+	Locale            string `json:"locale"`
+	ProblemName       string `json:"problem_name"`
+	Description       string `json:"description"`
+	InputDescription  string `json:"input_description"`
+	OutputDescription string `json:"output_description"`
+}
+
+// problemPackage problem.json of a problem package
+type problemPackage struct {
+	FormatVersion     int                       `json:"format_version"`
+	ProblemName       string                    `json:"problem_name"`
+	Description       string                    `json:"description"`
+	InputDescription  string                    `json:"input_description"`
+	OutputDescription string                    `json:"output_description"`
+	ProgramName       string                    `json:"program_name"`
+	MemoryLimit       uint                      `json:"memory_limit"`
+	CPUTime           uint                      `json:"cpu_time"`
+	Layer             uint8                     `json:"layer"`
+	Normalize         packageNormalize          `json:"normalize"`
+	Languages         []problemLanguageTemplate `json:"languages"`
+	Tags              []string                  `json:"tags_list"`
+	Samples           []packageSample           `json:"samples"`
+	Validator         *packageValidator         `json:"validator,omitempty"`
+	DefaultLocale     string                    `json:"default_locale,omitempty"`
+	Translations      []packageTranslation      `json:"translations,omitempty"`
+}
@@ -0,0 +1,204 @@
+package views
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/models"
+	"github.com/gin-gonic/gin"
+	"github.com/vincentinttsh/zero"
+)
+
+// SetProblemValidator 設定題目的測資驗證程式，已有 test case 時重新驗證
+func SetProblemValidator(c *gin.Context) {
+	var data validatorAPIRequest
+	var validator models.Validator
+
+	problem, cases, ok := getTestCaseProblem(c)
+	if !ok {
+		return
+	}
+
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "未按照格式填寫或未使用json",
+		})
+		return
+	}
+	if zero.IsZero(data) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "未填寫完成",
+		})
+		return
+	}
+
+	validator.ProblemID = problem.ID
+	validator.Language = *data.Language
+	validator.SourceCode = *data.SourceCode
+
+	validateTask := newValidateTask(&problem, &validator)
+	if err := validateTask.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := models.SetValidator(&validator); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	validating, err := updateTestCaseStatus(getOutbox(c), &problem, len(cases))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "設定成功",
+		"problem_id": problem.ID,
+		"validating": validating,
+	})
+}
+
+// GetProblemValidator 讀取題目的測資驗證程式與各 test case 驗證結果
+func GetProblemValidator(c *gin.Context) {
+	var validator models.Validator
+	var validations []models.TestCaseValidation
+	var err error
+	var results = make([]gin.H, 0)
+
+	problem, _, ok := getTestCaseProblem(c)
+	if !ok {
+		return
+	}
+
+	if validator, err = models.GetValidatorByProblemID(problem.ID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "無驗證程式",
+		})
+		return
+	}
+
+	if validations, err = models.GetTestCaseValidations(problem.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	for _, v := range validations {
+		results = append(results, gin.H{
+			"test_case": v.TestCase,
+			"checked":   v.Checked,
+			"valid":     v.Valid,
+			"message":   v.Message,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"problem_id":    problem.ID,
+		"language":      validator.Language,
+		"source_code":   validator.SourceCode,
+		"has_test_case": problem.HasTestCase,
+		"results":       results,
+	})
+}
+
+// DeleteProblemValidator 刪除題目的測資驗證程式
+func DeleteProblemValidator(c *gin.Context) {
+	problem, cases, ok := getTestCaseProblem(c)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteValidator(problem.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	if _, err := updateTestCaseStatus(getOutbox(c), &problem, len(cases)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "刪除成功",
+		"problem_id": problem.ID,
+	})
+}
+
+// UpdateTestCaseValidation update test case validation result - judge service
+func UpdateTestCaseValidation(c *gin.Context) {
+	var problemID uint
+	var problem models.Problem
+	var data validationAPIRequest
+	var allValid bool
+	var id int
+	var err error
+
+	if id, err = strconv.Atoi(c.Params.ByName("id")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "problem id is invalid",
+		})
+		return
+	}
+	problemID = uint(id)
+
+	if err = c.BindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "json error",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if problem, err = models.GetProblemByID(problemID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "無此題目",
+		})
+		return
+	}
+
+	if allValid, err = models.UpdateTestCaseValidations(problemID, data.RunID, data.Results); err != nil {
+		if errors.Is(err, models.ErrStaleValidation) {
+			// 驗證程式或 test case 已更新，捨棄舊的驗證結果
+			c.JSON(http.StatusOK, gin.H{
+				"message":       err.Error(),
+				"has_test_case": problem.HasTestCase,
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "system error",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if problem.HasTestCase != allValid {
+		if err = models.SetProblemHasTestCase(problem.ID, allValid); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"message": "system error",
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "update success",
+		"has_test_case": allValid,
+	})
+}
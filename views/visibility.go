@@ -0,0 +1,208 @@
+package views
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NCNUCodeOJ/BackendQuestionDatabase/models"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// viewer 目前的使用者，群組與競賽來自 jwt
+type viewer struct {
+	userID   uint
+	admin    bool
+	groups   []uint
+	contests []uint
+}
+
+// currentViewer 讀取 getUserID 設定的使用者資料
+func currentViewer(c *gin.Context) (v viewer) {
+	v.userID = c.MustGet("userID").(uint)
+	v.admin = c.GetBool("admin")
+	v.groups, _ = c.Value("groups").([]uint)
+	v.contests, _ = c.Value("contests").([]uint)
+	return
+}
+
+func containsID(ids []uint, id uint) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// canViewProblem 使用者是否可以看到題目，有題目權限的使用者可以看到未公開的題目
+func canViewProblem(problem *models.Problem, v *viewer) (bool, error) {
+	if ok, err := hasProblemRole(problem, v, models.RoleViewer); err != nil || ok {
+		return ok, err
+	}
+
+	switch problem.EffectiveVisibility(time.Now()) {
+	case models.VisibilityPublic:
+		return true, nil
+	case models.VisibilityShared:
+		shares, err := models.GetProblemShares(problem.ID)
+		if err != nil {
+			return false, err
+		}
+		for _, share := range shares {
+			if share.Kind == models.ShareGroup && containsID(v.groups, share.TargetID) ||
+				share.Kind == models.ShareContest && containsID(v.contests, share.TargetID) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// contestAllowed 提交的競賽需在使用者 jwt 的 contests 中，且題目有分享給該競賽
+func contestAllowed(problemID uint, v *viewer, contestID uint) (bool, error) {
+	if !containsID(v.contests, contestID) {
+		return false, nil
+	}
+	shares, err := models.GetProblemShares(problemID)
+	if err != nil {
+		return false, err
+	}
+	for _, share := range shares {
+		if share.Kind == models.ShareContest && share.TargetID == contestID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// filterVisibleProblems 只保留使用者可以看到的題目，草稿不列出
+func filterVisibleProblems(problems []models.Problem, v *viewer) (visible []models.Problem, err error) {
+	for i := range problems {
+		var ok bool
+
+		if problems[i].Visibility == models.VisibilityDraft {
+			continue
+		}
+		if ok, err = canViewProblem(&problems[i], v); err != nil {
+			return nil, err
+		}
+		if ok {
+			visible = append(visible, problems[i])
+		}
+	}
+	return
+}
+
+// getVisibleProblem 讀取使用者可以看到的題目，看不到的題目視為不存在
+func getVisibleProblem(c *gin.Context, problemID uint) (problem models.Problem, ok bool) {
+	var err error
+
+	if problem, err = models.GetProblemByID(problemID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "無此題目",
+		})
+		return
+	}
+	v := currentViewer(c)
+	if ok, err = canViewProblem(&problem, &v); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return problem, false
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "無此題目",
+		})
+	}
+	return
+}
+
+// SetProblemVisibility 設定題目的公開狀態、分享對象與排程公開時間
+func SetProblemVisibility(c *gin.Context) {
+	var data visibilityAPIRequest
+	var shares []models.ProblemShare
+
+	id, err := strconv.Atoi(c.Params.ByName("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "problem id is invalid",
+		})
+		return
+	}
+	problem, err := models.GetProblemByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "無此題目",
+		})
+		return
+	}
+
+	if err := c.ShouldBindBodyWith(&data, binding.JSON); err != nil || data.Visibility == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "未按照格式填寫或未使用json",
+		})
+		return
+	}
+	switch *data.Visibility {
+	case models.VisibilityDraft, models.VisibilityPrivate, models.VisibilityPublic:
+	case models.VisibilityShared:
+		if len(data.Groups) == 0 && len(data.Contests) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "shared problem requires groups or contests",
+			})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "visibility must be draft, private, shared or public",
+		})
+		return
+	}
+	if data.PublishAt != nil && *data.Visibility == models.VisibilityPublic {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "public problem cannot be scheduled",
+		})
+		return
+	}
+	if data.PublishAt != nil && *data.Visibility == models.VisibilityDraft {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "draft problem cannot be scheduled",
+		})
+		return
+	}
+
+	for _, group := range data.Groups {
+		shares = append(shares, models.ProblemShare{Kind: models.ShareGroup, TargetID: group})
+	}
+	for _, contest := range data.Contests {
+		shares = append(shares, models.ProblemShare{Kind: models.ShareContest, TargetID: contest})
+	}
+	if *data.Visibility != models.VisibilityShared {
+		shares = nil
+	}
+	if err = models.SetProblemShares(problem.ID, shares); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	problem.Visibility = *data.Visibility
+	problem.PublishAt = data.PublishAt
+	if err = models.UpdateProblem(&problem); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "系統錯誤",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "題目公開狀態設定成功",
+		"problem_id": problem.ID,
+		"visibility": problem.Visibility,
+		"publish_at": problem.PublishAt,
+	})
+}